@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const archiveFileName = "download-archive.json"
+
+// archiveEntry mémorise un téléchargement abouti, pour le resservir à une
+// demande identique plutôt que de relancer le téléchargeur.
+type archiveEntry struct {
+	VideoID     string     `json:"videoId"`
+	URL         string     `json:"url"`
+	Mode        string     `json:"mode"`
+	Preset      string     `json:"preset"`
+	Title       string     `json:"title"`
+	JobID       string     `json:"jobId"`
+	CompletedAt time.Time  `json:"completedAt"`
+	Result      *jobResult `json:"result"`
+}
+
+// downloadArchive est l'historique persistant des téléchargements, indexé
+// par vidéo et réglages effectifs.
+type downloadArchive struct {
+	mu      sync.Mutex
+	saveMu  sync.Mutex
+	path    string
+	entries map[string]*archiveEntry
+}
+
+var (
+	archive *downloadArchive
+	// activeDownloads associe une clé de déduplication au travail en cours.
+	activeDownloads sync.Map
+)
+
+func newDownloadArchive(dir string) *downloadArchive {
+	a := &downloadArchive{
+		path:    filepath.Join(dir, archiveFileName),
+		entries: make(map[string]*archiveEntry),
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Lecture de l'archive %s impossible: %v\n", a.path, err)
+		}
+		return a
+	}
+	if err := json.Unmarshal(data, &a.entries); err != nil {
+		log.Printf("Archive %s ignorée: %v\n", a.path, err)
+		a.entries = make(map[string]*archiveEntry)
+	}
+	return a
+}
+
+// dedupKey identifie une vidéo téléchargée avec des réglages donnés: deux
+// demandes de même clé produiraient le même fichier. Les arguments du
+// préréglage couvrent les options de format; la cible de volume et les
+// options du travail qui modifient la sortie sont ajoutées à l'empreinte.
+func dedupKey(videoID string, p preset, opts jobOptions) string {
+	output := struct {
+		Args           []string
+		LoudnessTarget float64
+		EmbedMetadata  bool
+		EmbedThumbnail bool
+		SplitArtist    bool
+		Tags           tagOptions
+		Subtitles      *subtitleOptions
+		SplitChapters  bool
+		SponsorBlock   *sponsorBlockOptions
+		Collision      string
+	}{
+		Args:           presetArgs(p),
+		LoudnessTarget: p.LoudnessTarget,
+		EmbedMetadata:  opts.EmbedMetadata,
+		EmbedThumbnail: opts.EmbedThumbnail,
+		SplitArtist:    opts.SplitArtist,
+		Tags:           opts.Tags,
+		SplitChapters:  opts.SplitChapters,
+		Collision:      opts.Collision,
+	}
+	// Langues et catégories sont des ensembles: leur ordre est sans effet.
+	if sub := opts.Subtitles; sub != nil {
+		canonical := *sub
+		canonical.Languages = sortedCopy(sub.Languages)
+		output.Subtitles = &canonical
+	}
+	if sb := opts.SponsorBlock; sb != nil {
+		canonical := *sb
+		canonical.Categories = sortedCopy(sb.Categories)
+		output.SponsorBlock = &canonical
+	}
+	data, _ := json.Marshal(output)
+	sum := sha1.Sum(data)
+	return strings.Join([]string{videoID, p.Mode, p.Name, hex.EncodeToString(sum[:4])}, "|")
+}
+
+func sortedCopy(list []string) []string {
+	out := append([]string(nil), list...)
+	sort.Strings(out)
+	return out
+}
+
+// lookup renvoie l'entrée archivée si tous ses fichiers existent encore;
+// une entrée dont les fichiers ont disparu est oubliée.
+func (a *downloadArchive) lookup(key string) *archiveEntry {
+	a.mu.Lock()
+	entry, ok := a.entries[key]
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if entry.Result == nil || len(entry.Result.Files) == 0 {
+		a.forget(key)
+		return nil
+	}
+	for _, f := range entry.Result.Files {
+		if _, err := os.Stat(f); err != nil {
+			a.forget(key)
+			return nil
+		}
+	}
+	return entry
+}
+
+// byFile indexe les entrées par fichier produit.
+func (a *downloadArchive) byFile() map[string]*archiveEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	files := make(map[string]*archiveEntry)
+	for _, entry := range a.entries {
+		if entry.Result == nil {
+			continue
+		}
+		for _, f := range entry.Result.Files {
+			files[filepath.Clean(f)] = entry
+		}
+	}
+	return files
+}
+
+// renameFile reporte le déplacement d'un fichier dans les entrées qui le citent.
+func (a *downloadArchive) renameFile(from, to string) {
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	changed := false
+	a.mu.Lock()
+	for _, entry := range a.entries {
+		if entry.Result == nil {
+			continue
+		}
+		for i, f := range entry.Result.Files {
+			if filepath.Clean(f) != from {
+				continue
+			}
+			result := *entry.Result
+			result.Files = append([]string(nil), entry.Result.Files...)
+			result.Files[i] = to
+			entry.Result = &result
+			changed = true
+			break
+		}
+	}
+	a.mu.Unlock()
+	if changed {
+		a.save()
+	}
+}
+
+// forgetFile oublie les entrées dont un fichier a été supprimé, pour qu'une
+// nouvelle demande relance le téléchargement.
+func (a *downloadArchive) forgetFile(path string) {
+	path = filepath.Clean(path)
+	changed := false
+	a.mu.Lock()
+	for key, entry := range a.entries {
+		if entry.Result == nil {
+			continue
+		}
+		for _, f := range entry.Result.Files {
+			if filepath.Clean(f) == path {
+				delete(a.entries, key)
+				changed = true
+				break
+			}
+		}
+	}
+	a.mu.Unlock()
+	if changed {
+		a.save()
+	}
+}
+
+func (a *downloadArchive) record(key string, entry *archiveEntry) {
+	a.mu.Lock()
+	a.entries[key] = entry
+	a.mu.Unlock()
+	a.save()
+}
+
+func (a *downloadArchive) forget(key string) {
+	a.mu.Lock()
+	_, ok := a.entries[key]
+	delete(a.entries, key)
+	a.mu.Unlock()
+	if ok {
+		a.save()
+	}
+}
+
+func (a *downloadArchive) save() {
+	a.saveMu.Lock()
+	defer a.saveMu.Unlock()
+	a.mu.Lock()
+	data, err := json.MarshalIndent(a.entries, "", "  ")
+	a.mu.Unlock()
+	if err != nil {
+		log.Printf("Archive non enregistrée: %v\n", err)
+		return
+	}
+	if err := writeFileAtomic(a.path, data); err != nil {
+		log.Printf("Archive non enregistrée: %v\n", err)
+	}
+}
+
+// claimDownload prépare la déduplication du travail j. Il renvoie le
+// travail à suivre à sa place s'il en existe un: un travail identique en
+// cours, ou un travail terminé reconstitué depuis l'archive (sauf Force).
+func claimDownload(j *job, videoID, url string) *job {
+	j.mu.Lock()
+	j.sourceURL = url
+	j.mu.Unlock()
+	if videoID == "" || j.opts.Range != nil {
+		return nil
+	}
+	j.key = dedupKey(videoID, j.preset, j.opts)
+	j.videoID = videoID
+	if !j.opts.Force {
+		if entry := archive.lookup(j.key); entry != nil {
+			return archivedJob(j, entry)
+		}
+	}
+	if value, loaded := activeDownloads.LoadOrStore(j.key, j); loaded {
+		existing := value.(*job)
+		if !existing.snapshot().Finished {
+			existing.appendLog("Demande identique rattachée à ce travail")
+			return existing
+		}
+		activeDownloads.Store(j.key, j)
+	}
+	return nil
+}
+
+// archivedJob termine d'emblée le travail avec le résultat archivé.
+func archivedJob(job *job, entry *archiveEntry) *job {
+	completion := time.Now()
+	result := *entry.Result
+	job.appendLog(fmt.Sprintf("Déjà téléchargé le %s; forcez le téléchargement pour le refaire.", entry.CompletedAt.Local().Format("02/01/2006 15:04")))
+	job.update(func(s *jobStatus) {
+		s.Title = entry.Title
+		s.Status = "terminé"
+		s.Archived = true
+		s.DownloadPct = 100
+		s.ConversionPct = 100
+		s.Result = &result
+		s.Finished = true
+		s.CompletedAt = &completion
+	})
+	return job
+}
+
+// releaseDownload libère la clé du travail et archive son résultat s'il a abouti.
+func releaseDownload(job *job) {
+	if job.key == "" {
+		return
+	}
+	activeDownloads.CompareAndDelete(job.key, job)
+	st := job.snapshot()
+	if st.Status != "terminé" || st.Result == nil || len(st.Result.Files) == 0 {
+		return
+	}
+	archive.record(job.key, &archiveEntry{
+		VideoID:     job.videoID,
+		URL:         job.source(),
+		Mode:        st.Mode,
+		Preset:      st.Preset,
+		Title:       st.Title,
+		JobID:       st.ID,
+		CompletedAt: time.Now(),
+		Result:      st.Result,
+	})
+}
+
+// source renvoie l'URL téléchargée par le travail.
+func (j *job) source() string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.sourceURL
+}
+
+// duplicateKind indique pourquoi une demande n'a pas lancé de téléchargement.
+func duplicateKind(job *job) string {
+	if job.snapshot().Archived {
+		return "archived"
+	}
+	return "running"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// audioExtensions associe chaque codec accepté par --audio-format à
+// l'extension du fichier produit par le téléchargeur.
+var audioExtensions = map[string]string{
+	"mp3":  "mp3",
+	"m4a":  "m4a",
+	"aac":  "aac",
+	"opus": "opus",
+	"flac": "flac",
+	"wav":  "wav",
+}
+
+var audioBitrates = []string{"128", "192", "256", "320"}
+
+func isLosslessCodec(codec string) bool {
+	return codec == "flac" || codec == "wav"
+}
+
+// applyAudioOptions surcharge le codec et la qualité du préréglage pour un travail.
+// La qualité vaut "0" (meilleure VBR) ou un débit en kbit/s parmi audioBitrates.
+func applyAudioOptions(p *preset, codec, quality string) error {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+	quality = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(quality)), "k")
+	if codec == "" && quality == "" {
+		return nil
+	}
+	if p.Mode != "audio" {
+		return fmt.Errorf("le préréglage %q ne produit pas d'audio seul", p.Name)
+	}
+	if codec != "" {
+		if _, ok := audioExtensions[codec]; !ok {
+			return fmt.Errorf("format audio %q non pris en charge", codec)
+		}
+		p.AudioCodec = codec
+		if isLosslessCodec(codec) {
+			p.AudioQuality = ""
+		}
+	}
+	if quality == "" {
+		return nil
+	}
+	if isLosslessCodec(p.AudioCodec) {
+		return fmt.Errorf("le format %s est sans perte, aucun débit n'est applicable", p.AudioCodec)
+	}
+	if quality == "0" {
+		p.AudioQuality = "0"
+		return nil
+	}
+	for _, b := range audioBitrates {
+		if quality == b {
+			p.AudioQuality = b + "K"
+			return nil
+		}
+	}
+	return fmt.Errorf("qualité audio %q invalide (0, %s)", quality, strings.Join(audioBitrates, ", "))
+}
+
+func expectedExtension(p preset) string {
+	if p.Mode == "audio" {
+		return audioExtensions[p.AudioCodec]
+	}
+	return p.Container
+}
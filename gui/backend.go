@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"regexp"
+	"sync"
+)
+
+var (
+	backendOnce sync.Once
+	backendHelp string
+)
+
+// backendSupports indique si le téléchargeur installé connaît l'option donnée;
+// les fonctions récentes (SponsorBlock, sections...) n'existent que dans yt-dlp.
+func backendSupports(flag string) bool {
+	backendOnce.Do(func() {
+		out, err := exec.Command(ytdlPath, "--help").Output()
+		if err != nil {
+			log.Printf("Options du téléchargeur indisponibles: %v\n", err)
+		}
+		backendHelp = string(out)
+	})
+	re := regexp.MustCompile(`(?m)(?:^|[\s,])` + regexp.QuoteMeta(flag) + `(?:[\s,=]|$)`)
+	return re.MatchString(backendHelp)
+}
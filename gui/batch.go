@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxBatchURLs     = 200
+	batchConcurrency = 2
+)
+
+var batches sync.Map
+
+// batch regroupe les travaux créés par une même soumission de plusieurs URL.
+type batch struct {
+	ID        string      `json:"id"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Items     []batchItem `json:"items"`
+}
+
+// batchItem associe une URL soumise à son travail, ou à l'erreur qui a
+// empêché sa création sans rejeter le reste du lot.
+type batchItem struct {
+	URL   string `json:"url"`
+	JobID string `json:"jobId,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+	// Duplicate signale un travail existant réutilisé ("running" ou "archived").
+	Duplicate string `json:"duplicate,omitempty"`
+}
+
+type batchItemStatus struct {
+	batchItem
+	Title       string  `json:"title,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	DownloadPct float64 `json:"downloadPct"`
+	Finished    bool    `json:"finished"`
+}
+
+type batchStatus struct {
+	ID          string            `json:"id"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Items       []batchItemStatus `json:"items"`
+	Counts      batchCounts       `json:"counts"`
+	DownloadPct float64           `json:"downloadPct"`
+	Finished    bool              `json:"finished"`
+}
+
+type batchCounts struct {
+	jobCounts
+	Running int `json:"running"`
+	Invalid int `json:"invalid"`
+}
+
+type batchResponse struct {
+	OK    bool         `json:"ok"`
+	Batch *batchStatus `json:"batch,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// batchURLs reprend la liste urls, ou découpe un champ url multiligne.
+func batchURLs(req *downloadRequest) []string {
+	raw := req.URLs
+	if len(raw) == 0 && strings.ContainsAny(strings.TrimSpace(req.URL), "\r\n") {
+		raw = strings.Split(req.URL, "\n")
+	}
+	var urls []string
+	for _, u := range raw {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func startBatch(w http.ResponseWriter, r *http.Request, req *downloadRequest, urls []string, p preset, opts jobOptions) {
+	if len(urls) > maxBatchURLs {
+		http.Error(w, fmt.Sprintf("trop d'URL dans le lot (%d au maximum)", maxBatchURLs), http.StatusBadRequest)
+		return
+	}
+	b := &batch{ID: newJobID(), CreatedAt: time.Now()}
+	var runs []func()
+	for _, raw := range urls {
+		item := batchItem{URL: raw}
+		job, run, err := createJob(r.Context(), req, raw, p, opts)
+		if err != nil {
+			item.Error = err.Error()
+			item.Code = policyCode(err)
+		} else if run == nil {
+			item.JobID = job.snapshot().ID
+			item.Duplicate = duplicateKind(job)
+		} else {
+			id := b.ID
+			job.update(func(s *jobStatus) {
+				s.BatchID = id
+				s.Status = "en attente"
+			})
+			item.JobID = job.snapshot().ID
+			runs = append(runs, run)
+		}
+		b.Items = append(b.Items, item)
+	}
+	batches.Store(b.ID, b)
+
+	go func() {
+		sem := make(chan struct{}, batchConcurrency)
+		var wg sync.WaitGroup
+		for _, run := range runs {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(run func()) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				run()
+			}(run)
+		}
+		wg.Wait()
+	}()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(downloadResponse{OK: true, BatchID: b.ID, Items: b.Items})
+}
+
+func (b *batch) status() *batchStatus {
+	st := &batchStatus{ID: b.ID, CreatedAt: b.CreatedAt, Finished: true}
+	var pct float64
+	for _, item := range b.Items {
+		is := batchItemStatus{batchItem: item}
+		if item.JobID == "" {
+			st.Counts.Invalid++
+			st.Items = append(st.Items, is)
+			continue
+		}
+		if value, ok := jobs.Load(item.JobID); ok {
+			js := value.(*job).snapshot()
+			is.Title, is.Status, is.DownloadPct, is.Finished = js.Title, js.Status, js.DownloadPct, js.Finished
+		}
+		st.Counts.Total++
+		switch {
+		case !is.Finished:
+			st.Counts.Running++
+			st.Finished = false
+			pct += is.DownloadPct
+		case is.Status == "erreur":
+			st.Counts.Failed++
+			pct += 100
+		case is.Status == "ignoré" || is.Status == "annulé":
+			st.Counts.Skipped++
+			pct += 100
+		default:
+			st.Counts.Done++
+			pct += 100
+		}
+		st.Items = append(st.Items, is)
+	}
+	if st.Counts.Total > 0 {
+		st.DownloadPct = pct / float64(st.Counts.Total)
+	}
+	return st
+}
+
+// batchesHandler sert GET /batches/{id}.
+func batchesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/batches/"), "/")
+	if strings.HasSuffix(id, "/zip") {
+		zipHandler(w, r, strings.TrimSuffix(id, "/zip"))
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "id manquant", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	value, ok := batches.Load(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(batchResponse{OK: false, Error: "lot introuvable"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(batchResponse{OK: true, Batch: value.(*batch).status()})
+}
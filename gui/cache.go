@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	cacheFileName          = "metadata-cache.json"
+	defaultCacheTTLMinutes = 30
+	defaultCacheMaxEntries = 200
+	// cacheSaveDelay regroupe les écritures du cache: une rafale d'ajouts
+	// (playlist, lot) ne réécrit le fichier qu'une fois.
+	cacheSaveDelay = 10 * time.Second
+)
+
+// cacheConfig règle le cache des informations vidéo; Persist le conserve
+// sur disque entre deux lancements.
+type cacheConfig struct {
+	TTLMinutes int  `json:"ttlMinutes"`
+	MaxEntries int  `json:"maxEntries"`
+	Persist    bool `json:"persist"`
+}
+
+type cacheEntry struct {
+	Info      *videoInfo `json:"info"`
+	FetchedAt time.Time  `json:"fetchedAt"`
+}
+
+type metadataCache struct {
+	mu      sync.Mutex
+	saveMu  sync.Mutex
+	entries map[string]cacheEntry
+	ttl     time.Duration
+	max     int
+	path    string
+	// saving vaut true tant qu'un enregistrement est programmé.
+	saving bool
+}
+
+var infoCache *metadataCache
+
+func newMetadataCache(c cacheConfig, dir string) *metadataCache {
+	if c.TTLMinutes <= 0 {
+		c.TTLMinutes = defaultCacheTTLMinutes
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = defaultCacheMaxEntries
+	}
+	mc := &metadataCache{
+		entries: make(map[string]cacheEntry),
+		ttl:     time.Duration(c.TTLMinutes) * time.Minute,
+		max:     c.MaxEntries,
+	}
+	if c.Persist {
+		mc.path = filepath.Join(dir, cacheFileName)
+		mc.load()
+	}
+	return mc
+}
+
+// videoCacheKey indexe les vidéos YouTube par identifiant, quelle que soit
+// la forme de l'URL; les autres URL sont indexées telles quelles.
+func videoCacheKey(normalized string) string {
+	if u, err := parseVideoURL(normalized); err == nil && u.VideoID != "" {
+		return u.VideoID
+	}
+	return normalized
+}
+
+func (c *metadataCache) get(key string) (*videoInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.FetchedAt) > c.ttl {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.Info, true
+}
+
+func (c *metadataCache) put(key string, info *videoInfo) {
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{Info: compactInfo(info), FetchedAt: time.Now()}
+	for len(c.entries) > c.max {
+		oldestKey := ""
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.FetchedAt.Before(oldest) {
+				oldestKey, oldest = k, e.FetchedAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	schedule := c.path != "" && !c.saving
+	c.saving = c.saving || schedule
+	c.mu.Unlock()
+	if schedule {
+		time.AfterFunc(cacheSaveDelay, c.save)
+	}
+}
+
+// compactInfo allège les informations gardées en cache: seules les langues
+// des sous-titres servent, une piste par langue suffit donc.
+func compactInfo(info *videoInfo) *videoInfo {
+	compact := *info
+	compact.Subtitles = oneTrackPerLanguage(info.Subtitles)
+	compact.AutomaticCaptions = oneTrackPerLanguage(info.AutomaticCaptions)
+	return &compact
+}
+
+func oneTrackPerLanguage(tracks map[string][]subtitleTrack) map[string][]subtitleTrack {
+	if tracks == nil {
+		return nil
+	}
+	out := make(map[string][]subtitleTrack, len(tracks))
+	for lang, list := range tracks {
+		if len(list) > 1 {
+			list = list[:1]
+		}
+		out[lang] = list
+	}
+	return out
+}
+
+func (c *metadataCache) load() {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Lecture du cache %s impossible: %v\n", c.path, err)
+		}
+		return
+	}
+	var entries map[string]cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("Cache %s ignoré: %v\n", c.path, err)
+		return
+	}
+	for k, e := range entries {
+		if e.Info != nil && time.Since(e.FetchedAt) <= c.ttl {
+			c.entries[k] = e
+		}
+	}
+}
+
+func (c *metadataCache) save() {
+	if c.path == "" {
+		return
+	}
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.mu.Lock()
+	c.saving = false
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		log.Printf("Cache non enregistré: %v\n", err)
+		return
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		log.Printf("Cache non enregistré: %v\n", err)
+	}
+}
+
+// fetchVideoInfo sert les informations depuis le cache quand elles sont
+// encore fraîches, et interroge le téléchargeur sinon.
+func fetchVideoInfo(ctx context.Context, normalized string) (*videoInfo, error) {
+	key := videoCacheKey(normalized)
+	if info, ok := infoCache.get(key); ok {
+		return info, nil
+	}
+	info, err := dumpVideoInfo(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+	infoCache.put(key, info)
+	return info, nil
+}
+
+func cachedVideoInfo(normalized string) *videoInfo {
+	info, _ := infoCache.get(videoCacheKey(normalized))
+	return info
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
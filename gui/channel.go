@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// channelFilters restreint les vidéos retenues d'une chaîne. Les dates sont
+// au format AAAAMMJJ, les durées en secondes (zéro: pas de limite).
+type channelFilters struct {
+	DateAfter     string
+	DateBefore    string
+	MaxItems      int
+	MinDuration   float64
+	MaxDuration   float64
+	IncludeShorts bool
+}
+
+// channelURL ramène une URL de chaîne (@pseudo, /channel/, /c/, /user/) à sa
+// racine, sans onglet.
+func channelURL(raw string) (string, error) {
+	u, err := parseVideoURL(raw)
+	if err != nil {
+		return "", err
+	}
+	switch u.Kind {
+	case urlKindChannel:
+		return u.Normalized, nil
+	case urlKindExternal:
+		return "", fmt.Errorf("le mode chaîne n'accepte que les chaînes YouTube")
+	}
+	return "", fmt.Errorf("URL de chaîne non reconnue (@pseudo, /channel/, /c/ ou /user/ attendu)")
+}
+
+func parseFilterDate(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	d, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return "", fmt.Errorf("date %q invalide (AAAA-MM-JJ attendu)", raw)
+	}
+	return d.Format("20060102"), nil
+}
+
+func (f channelFilters) validate() error {
+	if f.DateAfter != "" && f.DateBefore != "" && f.DateAfter > f.DateBefore {
+		return fmt.Errorf("la date de début suit la date de fin")
+	}
+	if f.MaxItems < 0 {
+		return fmt.Errorf("nombre maximal d'éléments invalide")
+	}
+	if f.MaxDuration > 0 && f.MinDuration > f.MaxDuration {
+		return fmt.Errorf("la durée minimale dépasse la durée maximale")
+	}
+	return nil
+}
+
+// startChannel énumère les onglets de la chaîne, applique les filtres puis
+// confie les vidéos retenues à runCollection.
+func startChannel(ctx context.Context, parent *job, base string, filters channelFilters, continueOnError bool) {
+	tabs := []string{base + "/videos"}
+	if filters.IncludeShorts {
+		tabs = append(tabs, base+"/shorts")
+	}
+	var selected []playlistEntry
+	for _, tab := range tabs {
+		parent.appendLog(fmt.Sprintf("Lecture de %s...", tab))
+		listCtx, cancel := context.WithTimeout(ctx, playlistTimeout)
+		var list playlistInfo
+		err := dumpJSON(listCtx, &list, "--flat-playlist", "-J", tab)
+		cancel()
+		if err != nil {
+			if tab == tabs[0] {
+				jobFailed(parent, err)
+				return
+			}
+			parent.appendLog(fmt.Sprintf("Onglet ignoré: %v", err))
+			continue
+		}
+		if st := parent.snapshot(); st.Title == "" {
+			parent.update(func(s *jobStatus) { s.Title = list.Title })
+		}
+		selected = append(selected, filterChannelEntries(ctx, parent, list.Entries, filters, len(selected))...)
+		if filters.MaxItems > 0 && len(selected) >= filters.MaxItems {
+			break
+		}
+	}
+	parent.appendLog(fmt.Sprintf("%d vidéos retenues", len(selected)))
+	runCollection(ctx, parent, selected, continueOnError)
+}
+
+// filterChannelEntries complète au besoin date et durée par une requête
+// d'informations; les onglets étant triés du plus récent au plus ancien, la
+// lecture s'arrête au premier élément antérieur à DateAfter. Les filtres
+// connus d'après la liste sont appliqués avant toute requête, et seules les
+// informations des vidéos retenues entrent dans le cache partagé, pour qu'un
+// long parcours n'en chasse pas les aperçus récents.
+func filterChannelEntries(ctx context.Context, parent *job, entries []playlistEntry, f channelFilters, already int) []playlistEntry {
+	needDate := f.DateAfter != "" || f.DateBefore != ""
+	needDuration := f.MinDuration > 0 || f.MaxDuration > 0
+	var kept []playlistEntry
+	lookups := 0
+	for _, e := range entries {
+		if f.MaxItems > 0 && already+len(kept) >= f.MaxItems {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if e.unavailable() {
+			continue
+		}
+		if f.tooOld(e) {
+			break
+		}
+		if !f.accepts(e, false) {
+			continue
+		}
+		var info *videoInfo
+		if (needDate && e.UploadDate == "") || (needDuration && e.Duration == 0) {
+			if info = cachedVideoInfo(e.watchURL()); info == nil {
+				if lookups == 0 {
+					parent.appendLog("Lecture des dates et durées manquantes...")
+				}
+				lookups++
+				var err error
+				if info, err = dumpVideoInfo(ctx, e.watchURL()); err != nil {
+					parent.appendLog(fmt.Sprintf("%s: informations indisponibles, ignoré (%v)", e.Title, err))
+					continue
+				}
+			}
+			e.UploadDate, e.Duration = info.UploadDate, info.Duration
+		}
+		if f.tooOld(e) {
+			break
+		}
+		if !f.accepts(e, true) {
+			continue
+		}
+		if info != nil {
+			infoCache.put(videoCacheKey(e.watchURL()), info)
+		}
+		kept = append(kept, e)
+	}
+	if lookups > 0 {
+		parent.appendLog(fmt.Sprintf("%d requête(s) d'informations pour filtrer la chaîne", lookups))
+	}
+	return kept
+}
+
+// tooOld signale un élément antérieur à DateAfter, qui clôt le parcours.
+func (f channelFilters) tooOld(e playlistEntry) bool {
+	return f.DateAfter != "" && e.UploadDate != "" && e.UploadDate < f.DateAfter
+}
+
+// accepts applique les filtres de date et de durée. Tant que les
+// informations ne sont pas complètes, une durée absente ne permet pas
+// d'écarter l'élément.
+func (f channelFilters) accepts(e playlistEntry, complete bool) bool {
+	if f.DateBefore != "" && e.UploadDate != "" && e.UploadDate > f.DateBefore {
+		return false
+	}
+	if complete || e.Duration > 0 {
+		if f.MinDuration > 0 && e.Duration < f.MinDuration {
+			return false
+		}
+		if f.MaxDuration > 0 && e.Duration > f.MaxDuration {
+			return false
+		}
+	}
+	return true
+}
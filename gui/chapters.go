@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type chapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Title     string  `json:"title"`
+}
+
+// splitByChapters découpe le fichier en une piste numérotée par chapitre,
+// rangées dans un dossier portant le nom du fichier d'origine, qui est supprimé.
+func splitByChapters(ctx context.Context, job *job, path string, info *videoInfo, tags map[string]string) ([]string, error) {
+	ext := filepath.Ext(path)
+	dir := strings.TrimSuffix(path, ext)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	album := tags["album"]
+	if album == "" {
+		album = info.Title
+	}
+	artist := tags["artist"]
+	if artist == "" {
+		artist = info.Channel
+	}
+
+	total := len(info.Chapters)
+	width := len(strconv.Itoa(total))
+	if width < 2 {
+		width = 2
+	}
+	var files []string
+	for i, ch := range info.Chapters {
+		title := strings.TrimSpace(ch.Title)
+		if title == "" {
+			title = fmt.Sprintf("Piste %d", i+1)
+		}
+		out := fitFileName(dir, fmt.Sprintf("%0*d - %s", width, i+1, title), ext, 0)
+		name := filepath.Base(out)
+		args := []string{"-ss", formatSeconds(ch.StartTime)}
+		if ch.EndTime > ch.StartTime {
+			args = append(args, "-to", formatSeconds(ch.EndTime))
+		}
+		args = append(args, "-i", path, "-map", "0", "-c", "copy", "-map_metadata", "0", "-map_chapters", "-1",
+			"-metadata", "title="+title,
+			"-metadata", fmt.Sprintf("track=%d/%d", i+1, total),
+			"-metadata", "album="+album,
+		)
+		if artist != "" {
+			args = append(args, "-metadata", "artist="+artist)
+		}
+		if date := tags["date"]; date != "" {
+			args = append(args, "-metadata", "date="+date)
+		}
+		if _, err := runFFmpeg(ctx, append(args, out)...); err != nil {
+			// Pas de découpage partiel: les pistes déjà écrites et celle en
+			// cours sont retirées, le fichier d'origine reste à postProcess.
+			for _, f := range append(files, out) {
+				_ = os.Remove(f)
+			}
+			_ = os.Remove(dir)
+			return nil, fmt.Errorf("chapitre %d: %w", i+1, err)
+		}
+		job.appendLog(fmt.Sprintf("Piste créée: %s", name))
+		files = append(files, out)
+	}
+	if err := os.Remove(path); err != nil {
+		job.appendLog(fmt.Sprintf("Fichier d'origine conservé: %v", err))
+	}
+	return files, nil
+}
+
+// embedChapters inscrit les marqueurs de chapitres dans le fichier, sans réencodage.
+func embedChapters(ctx context.Context, path string, chapters []chapter) error {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, ch := range chapters {
+		end := ch.EndTime
+		if end <= ch.StartTime {
+			continue
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(ch.StartTime*1000), int64(end*1000), escapeFFMetadata(ch.Title))
+	}
+	meta, err := os.CreateTemp("", "chapitres-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(meta.Name())
+	if _, err := meta.WriteString(b.String()); err != nil {
+		meta.Close()
+		return err
+	}
+	if err := meta.Close(); err != nil {
+		return err
+	}
+	_, err = rewriteInPlace(ctx, path, func(tmp string) []string {
+		return []string{"-i", path, "-i", meta.Name(), "-map", "0", "-map_metadata", "0", "-map_chapters", "1", "-c", "copy", tmp}
+	})
+	return err
+}
+
+func escapeFFMetadata(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n")
+	return r.Replace(s)
+}
+
+func formatSeconds(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultOrphanMaxAgeHours = 24
+
+// cleanupConfig règle le ménage des fichiers temporaires. KeepPartial garde
+// les .part et .ytdl d'un travail en échec pour qu'une nouvelle demande
+// identique reprenne le téléchargement là où il s'était arrêté.
+type cleanupConfig struct {
+	KeepPartial       bool `json:"keepPartial"`
+	OrphanMaxAgeHours int  `json:"orphanMaxAgeHours"`
+}
+
+var cleanupSettings cleanupConfig
+
+var (
+	// partialFileRe reconnaît les fichiers dont le téléchargeur se sert pour reprendre.
+	partialFileRe = regexp.MustCompile(`\.(?:part|ytdl)$|\.part-Frag\d+(?:\.part)?$`)
+	// stagedFileRe reconnaît les fichiers d'un travail pas encore renommés.
+	stagedFileRe = regexp.MustCompile(`^` + stagingPrefix + `[0-9a-f]{12,32}\.`)
+)
+
+func loadCleanup(c cleanupConfig) cleanupConfig {
+	if c.OrphanMaxAgeHours <= 0 {
+		c.OrphanMaxAgeHours = defaultOrphanMaxAgeHours
+	}
+	return c
+}
+
+// stagingID nomme les fichiers provisoires du travail. Il dérive de la clé
+// de déduplication quand elle existe, pour qu'un nouvel essai retrouve les
+// fichiers partiels conservés; sinon de l'identifiant du travail.
+func (j *job) stagingID() string {
+	if j.key == "" {
+		return j.snapshot().ID
+	}
+	sum := sha1.Sum([]byte(j.key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// trackArtifact retient un fichier annoncé par le téléchargeur, pour savoir
+// quels dossiers nettoyer si le travail échoue.
+func (j *job) trackArtifact(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, a := range j.artifacts {
+		if a == path {
+			return
+		}
+	}
+	j.artifacts = append(j.artifacts, path)
+}
+
+// cleanupArtifacts supprime les fichiers provisoires d'un travail en échec
+// ou annulé: fragments, .part, .ytdl, flux non fusionnés, sous-titres et
+// informations; les fichiers de reprise sont gardés si KeepPartial.
+func cleanupArtifacts(job *job) {
+	job.mu.RLock()
+	artifacts := append([]string(nil), job.artifacts...)
+	job.mu.RUnlock()
+	if len(artifacts) == 0 {
+		return
+	}
+	dirs := make(map[string]bool)
+	for _, a := range artifacts {
+		dirs[filepath.Dir(a)] = true
+	}
+	stem := stagingPrefix + job.stagingID() + "."
+	removed, kept := 0, 0
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || !strings.HasPrefix(name, stem) {
+				continue
+			}
+			if cleanupSettings.KeepPartial && partialFileRe.MatchString(name) {
+				kept++
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				job.appendLog(fmt.Sprintf("Fichier temporaire non supprimé: %v", err))
+				continue
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		job.appendLog(fmt.Sprintf("%d fichier(s) temporaire(s) supprimé(s)", removed))
+	}
+	if kept > 0 {
+		job.appendLog(fmt.Sprintf("%d fichier(s) partiel(s) conservé(s) pour reprise", kept))
+	}
+}
+
+// sweepOrphans supprime au démarrage les fichiers provisoires de l'application
+// (noms dl-<id>., .part et fragments compris) plus anciens que le seuil
+// configuré. Les autres fichiers temporaires des dossiers de la bibliothèque,
+// laissés par un navigateur ou un autre outil, ne sont pas les siens.
+func sweepOrphans() {
+	maxAge := time.Duration(cleanupSettings.OrphanMaxAgeHours) * time.Hour
+	seen := make(map[string]bool)
+	removed := 0
+	for _, folder := range library.folders {
+		walkFiles(folder.Path, func(path string, d fs.DirEntry) {
+			if seen[path] || !stagedFileRe.MatchString(d.Name()) {
+				return
+			}
+			seen[path] = true
+			fi, err := d.Info()
+			if err != nil || time.Since(fi.ModTime()) < maxAge {
+				return
+			}
+			if err := os.Remove(path); err != nil {
+				log.Printf("Fichier orphelin %s non supprimé: %v\n", path, err)
+				return
+			}
+			removed++
+		})
+	}
+	if removed > 0 {
+		log.Printf("%d fichier(s) temporaire(s) orphelin(s) supprimé(s)\n", removed)
+	}
+}
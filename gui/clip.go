@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	clockTimeRe    = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2}(?:\.\d+)?)$`)
+	durationTimeRe = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+(?:\.\d+)?)s?)?$`)
+)
+
+// timeRange délimite l'extrait à conserver, en secondes; End à zéro désigne la fin de la vidéo.
+type timeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end,omitempty"`
+}
+
+// parseTimestamp accepte "90", "90.5", "1:30", "1:02:03" ou "1m30s".
+func parseTimestamp(raw string) (float64, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" {
+		return 0, nil
+	}
+	if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 {
+		return v, nil
+	}
+	if m := clockTimeRe.FindStringSubmatch(raw); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		mins, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.ParseFloat(m[3], 64)
+		if mins < 60 && sec < 60 {
+			return float64(h*3600+mins*60) + sec, nil
+		}
+	}
+	if m := durationTimeRe.FindStringSubmatch(raw); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		mins, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.ParseFloat(m[3], 64)
+		return float64(h*3600+mins*60) + sec, nil
+	}
+	return 0, fmt.Errorf("horodatage %q invalide", raw)
+}
+
+// resolveTimeRange valide l'extrait demandé contre la durée de la vidéo; le
+// t= de l'URL sert de début à défaut de start explicite.
+func resolveTimeRange(ctx context.Context, u *videoURL, start, end string) (*timeRange, error) {
+	if strings.TrimSpace(start) == "" && u.Timestamp > 0 {
+		start = formatSeconds(u.Timestamp)
+	}
+	if strings.TrimSpace(start) == "" && strings.TrimSpace(end) == "" {
+		return nil, nil
+	}
+	var r timeRange
+	var err error
+	if r.Start, err = parseTimestamp(start); err != nil {
+		return nil, err
+	}
+	if r.End, err = parseTimestamp(end); err != nil {
+		return nil, err
+	}
+	if r.End > 0 && r.End <= r.Start {
+		return nil, fmt.Errorf("la fin de l'extrait doit suivre son début")
+	}
+	if r.Start == 0 && r.End == 0 {
+		return nil, nil
+	}
+	info, err := fetchVideoInfo(ctx, u.Normalized)
+	if err != nil {
+		return nil, fmt.Errorf("durée de la vidéo inconnue: %w", err)
+	}
+	if info.Duration > 0 {
+		if r.Start >= info.Duration {
+			return nil, fmt.Errorf("le début (%s) dépasse la durée de la vidéo (%s)", formatClock(r.Start), formatClock(info.Duration))
+		}
+		if r.End > info.Duration {
+			return nil, fmt.Errorf("la fin (%s) dépasse la durée de la vidéo (%s)", formatClock(r.End), formatClock(info.Duration))
+		}
+	}
+	return &r, nil
+}
+
+// sectionArgs confie la découpe au téléchargeur quand il sait télécharger
+// une section; sinon l'extrait est taillé après coup par trimToRange.
+func sectionArgs(r *timeRange) []string {
+	if r == nil || !backendSupports("--download-sections") {
+		return nil
+	}
+	end := "inf"
+	if r.End > 0 {
+		end = formatSeconds(r.End)
+	}
+	return []string{"--download-sections", "*" + formatSeconds(r.Start) + "-" + end}
+}
+
+func trimToRange(ctx context.Context, path string, r *timeRange) error {
+	_, err := rewriteInPlace(ctx, path, func(tmp string) []string {
+		args := []string{"-ss", formatSeconds(r.Start)}
+		if r.End > 0 {
+			args = append(args, "-to", formatSeconds(r.End))
+		}
+		return append(args, "-i", path, "-map", "0", "-c", "copy", "-map_metadata", "0", tmp)
+	})
+	return err
+}
+
+func formatClock(seconds float64) string {
+	total := int(seconds)
+	h, m, s := total/3600, total%3600/60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func rangeEndLabel(r *timeRange) string {
+	if r.End == 0 {
+		return "fin"
+	}
+	return formatClock(r.End)
+}
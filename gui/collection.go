@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const playlistTimeout = 5 * time.Minute
+
+// collectionOptions règle l'expansion d'une playlist en travaux enfants:
+// sélection d'éléments ("1-5,8,12-") et poursuite malgré les échecs.
+type collectionOptions struct {
+	Items           string
+	ContinueOnError bool
+}
+
+type jobCounts struct {
+	Total   int `json:"total"`
+	Done    int `json:"done"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+type playlistEntry struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url"`
+	Duration   float64 `json:"duration"`
+	UploadDate string  `json:"upload_date"`
+}
+
+type playlistInfo struct {
+	ID      string          `json:"id"`
+	Title   string          `json:"title"`
+	Entries []playlistEntry `json:"entries"`
+}
+
+type itemRange struct {
+	From, To int
+}
+
+// playlistURL ramène l'URL collée à celle de sa playlist (list=), y compris
+// depuis une vidéo lue au sein d'une playlist.
+func playlistURL(raw string) (string, error) {
+	u, err := parseVideoURL(raw)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case u.Kind == urlKindExternal:
+		return u.Normalized, nil
+	case u.PlaylistID == "":
+		return "", fmt.Errorf("aucune playlist (list=) dans cette URL")
+	}
+	return "https://www.youtube.com/playlist?list=" + u.PlaylistID, nil
+}
+
+func parseItemRanges(spec string) ([]itemRange, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	var ranges []itemRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		var r itemRange
+		var err error
+		if r.From, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || r.From < 1 {
+			return nil, fmt.Errorf("sélection d'éléments %q invalide", part)
+		}
+		if strings.TrimSpace(to) != "" {
+			if r.To, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || r.To < r.From {
+				return nil, fmt.Errorf("sélection d'éléments %q invalide", part)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func selectEntries(entries []playlistEntry, ranges []itemRange) []playlistEntry {
+	if len(ranges) == 0 {
+		return entries
+	}
+	var selected []playlistEntry
+	for i, e := range entries {
+		n := i + 1
+		for _, r := range ranges {
+			if n >= r.From && (r.To == 0 || n <= r.To) {
+				selected = append(selected, e)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func (e playlistEntry) watchURL() string {
+	if strings.HasPrefix(e.URL, "http://") || strings.HasPrefix(e.URL, "https://") {
+		return e.URL
+	}
+	if e.ID != "" {
+		return "https://www.youtube.com/watch?v=" + e.ID
+	}
+	return ""
+}
+
+func (e playlistEntry) unavailable() bool {
+	switch e.Title {
+	case "[Private video]", "[Deleted video]", "[Vidéo privée]", "[Vidéo supprimée]":
+		return true
+	}
+	return e.watchURL() == ""
+}
+
+// startPlaylist énumère la playlist puis télécharge ses éléments un à un.
+func startPlaylist(ctx context.Context, parent *job, listURL string, copts collectionOptions) {
+	parent.appendLog("Lecture de la playlist...")
+	listCtx, cancel := context.WithTimeout(ctx, playlistTimeout)
+	var list playlistInfo
+	err := dumpJSON(listCtx, &list, "--flat-playlist", "-J", "--yes-playlist", listURL)
+	cancel()
+	if err != nil {
+		jobFailed(parent, err)
+		return
+	}
+	ranges, _ := parseItemRanges(copts.Items)
+	entries := selectEntries(list.Entries, ranges)
+	parent.update(func(s *jobStatus) { s.Title = list.Title })
+	parent.appendLog(fmt.Sprintf("Playlist « %s »: %d éléments retenus sur %d", list.Title, len(entries), len(list.Entries)))
+	runCollection(ctx, parent, entries, copts.ContinueOnError)
+}
+
+// runCollection crée un travail enfant par entrée et les exécute dans
+// l'ordre, en tenant à jour la progression agrégée du parent.
+func runCollection(ctx context.Context, parent *job, entries []playlistEntry, continueOnError bool) {
+	parentID := parent.snapshot().ID
+	children := make([]*job, len(entries))
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		child := newJob(parent.preset, parent.opts)
+		title := e.Title
+		child.update(func(s *jobStatus) {
+			s.ParentID = parentID
+			s.Title = title
+			s.Status = "en attente"
+		})
+		children[i] = child
+		ids[i] = child.snapshot().ID
+		jobs.Store(ids[i], child)
+	}
+	parent.update(func(s *jobStatus) {
+		s.Children = ids
+		s.Counts = &jobCounts{Total: len(children)}
+		s.Status = "téléchargement"
+	})
+	if len(children) == 0 {
+		finishCollection(parent, children)
+		return
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				refreshAggregate(parent, children)
+			}
+		}
+	}()
+
+	halted := false
+	for i, child := range children {
+		label := fmt.Sprintf("[%d/%d] %s", i+1, len(children), entries[i].Title)
+		switch {
+		case ctx.Err() != nil:
+			skipJob(child, "annulé")
+		case halted:
+			skipJob(child, "ignoré après une erreur")
+		case entries[i].unavailable():
+			skipJob(child, "vidéo indisponible")
+			parent.appendLog(label + ": indisponible, ignoré")
+		default:
+			if dup := claimDownload(child, entries[i].ID, entries[i].watchURL()); dup == child {
+				parent.appendLog(label + ": déjà téléchargé")
+				break
+			} else if dup != nil {
+				skipJob(child, "déjà en cours de téléchargement")
+				parent.appendLog(label + ": déjà en cours dans un autre travail, ignoré")
+				break
+			}
+			parent.appendLog(label)
+			startDownload(ctx, child, entries[i].watchURL())
+			if st := child.snapshot(); st.Status == "erreur" {
+				parent.appendLog(fmt.Sprintf("%s: échec (%s)", label, st.Error))
+				if !continueOnError {
+					halted = true
+					parent.appendLog("Arrêt de la playlist après cette erreur")
+				}
+			}
+		}
+		refreshAggregate(parent, children)
+	}
+	close(stop)
+	finishCollection(parent, children)
+}
+
+func skipJob(job *job, reason string) {
+	completion := time.Now()
+	job.appendLog(reason)
+	job.update(func(s *jobStatus) {
+		s.Status = "ignoré"
+		s.Finished = true
+		s.CompletedAt = &completion
+	})
+}
+
+func refreshAggregate(parent *job, children []*job) {
+	counts := jobCounts{Total: len(children)}
+	var pct float64
+	for _, child := range children {
+		st := child.snapshot()
+		switch {
+		case !st.Finished:
+			pct += st.DownloadPct
+		case st.Status == "erreur":
+			counts.Failed++
+			pct += 100
+		case st.Status == "ignoré" || st.Status == "annulé":
+			counts.Skipped++
+			pct += 100
+		default:
+			counts.Done++
+			pct += 100
+		}
+	}
+	parent.update(func(s *jobStatus) {
+		s.Counts = &counts
+		if counts.Total > 0 {
+			s.DownloadPct = pct / float64(counts.Total)
+		}
+		s.Message = fmt.Sprintf("%d terminés, %d en échec, %d ignorés sur %d", counts.Done, counts.Failed, counts.Skipped, counts.Total)
+	})
+}
+
+func finishCollection(parent *job, children []*job) {
+	refreshAggregate(parent, children)
+	result := &jobResult{Ext: expectedExtension(parent.preset)}
+	for _, child := range children {
+		if st := child.snapshot(); st.Result != nil {
+			result.Files = append(result.Files, st.Result.Files...)
+		}
+	}
+	st := parent.snapshot()
+	if parent.isCancelled() {
+		jobFailed(parent, errJobCancelled)
+		return
+	}
+	if st.Counts.Total > 0 && st.Counts.Failed == st.Counts.Total {
+		jobFailed(parent, fmt.Errorf("tous les éléments ont échoué"))
+		return
+	}
+	completion := time.Now()
+	parent.appendLog(st.Message)
+	parent.update(func(s *jobStatus) {
+		s.Status = "terminé"
+		s.DownloadPct = 100
+		s.ConversionPct = 100
+		s.Result = result
+		s.Finished = true
+		s.CompletedAt = &completion
+	})
+}
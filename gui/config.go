@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const configFileName = "config.json"
+
+// appConfig regroupe les réglages optionnels lus dans config.json, à côté de l'exécutable.
+type appConfig struct {
+	Presets   []preset      `json:"presets"`
+	Cache     cacheConfig   `json:"cache"`
+	Hooks     []hookConfig  `json:"hooks"`
+	URLPolicy urlPolicy     `json:"urlPolicy"`
+	Library   libraryConfig `json:"library"`
+	Storage   storageConfig `json:"storage"`
+	Cleanup   cleanupConfig `json:"cleanup"`
+}
+
+var cfg appConfig
+
+func loadConfig(dir string) appConfig {
+	var c appConfig
+	path := filepath.Join(dir, configFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Lecture de %s impossible: %v\n", path, err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		log.Printf("Configuration %s invalide, valeurs par défaut utilisées: %v\n", path, err)
+		return appConfig{}
+	}
+	return c
+}
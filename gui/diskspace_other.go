@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// diskSpace renvoie l'espace disponible pour l'utilisateur et la taille du
+// volume contenant path.
+func diskSpace(path string) (free, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskSpace renvoie l'espace disponible pour l'utilisateur et la taille du
+// volume contenant path.
+func diskSpace(path string) (free, total uint64, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	r, _, callErr := procGetDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&free)),
+		uintptr(unsafe.Pointer(&total)),
+		0,
+	)
+	if r == 0 {
+		return 0, 0, callErr
+	}
+	return free, total, nil
+}
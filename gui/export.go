@@ -0,0 +1,230 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exportItem est une ligne du manifeste: un travail du lot et ses fichiers
+// tels que rangés dans l'archive.
+type exportItem struct {
+	Title    string   `json:"title"`
+	URL      string   `json:"url,omitempty"`
+	Duration float64  `json:"duration,omitempty"`
+	Status   string   `json:"status"`
+	Files    []string `json:"files,omitempty"`
+	paths    []string
+}
+
+// zipHandler sert GET /batches/{id}/zip pour un lot ou pour une playlist ou
+// une chaîne. L'archive est écrite au fil de l'eau, sans copie temporaire,
+// en mode stocké puisque les médias sont déjà compressés. manifest=csv ou
+// manifest=json y ajoute la liste des titres, URL et durées.
+func zipHandler(w http.ResponseWriter, r *http.Request, id string) {
+	manifest := r.URL.Query().Get("manifest")
+	if manifest != "" && manifest != "csv" && manifest != "json" {
+		http.Error(w, "manifeste csv ou json attendu", http.StatusBadRequest)
+		return
+	}
+	name, members, ok := exportJobs(id)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(batchResponse{OK: false, Error: "lot introuvable"})
+		return
+	}
+	items := exportItems(members)
+	files := 0
+	for _, item := range items {
+		files += len(item.paths)
+	}
+	if files == 0 {
+		http.Error(w, "aucun fichier terminé à exporter", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": sanitizeFileName(name) + ".zip"}))
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	for i := range items {
+		if err := addItemFiles(zw, used, &items[i]); err != nil {
+			// L'en-tête est parti: on ne peut plus qu'interrompre l'archive.
+			log.Printf("Export %s interrompu: %v\n", id, err)
+			return
+		}
+	}
+	if manifest != "" {
+		if err := writeManifest(zw, manifest, items); err != nil {
+			log.Printf("Manifeste de l'export %s non écrit: %v\n", id, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Export %s interrompu: %v\n", id, err)
+	}
+}
+
+// exportJobs retrouve les travaux d'un lot, ou les enfants d'une playlist ou
+// d'une chaîne; name sert de nom à l'archive.
+func exportJobs(id string) (name string, members []*job, ok bool) {
+	if value, found := batches.Load(id); found {
+		for _, item := range value.(*batch).Items {
+			if v, ok := jobs.Load(item.JobID); ok {
+				members = append(members, v.(*job))
+			}
+		}
+		return "lot-" + shortID(id), members, true
+	}
+	value, found := jobs.Load(id)
+	if !found {
+		return "", nil, false
+	}
+	parent := value.(*job)
+	st := parent.snapshot()
+	if st.Kind != "playlist" && st.Kind != "channel" {
+		return "", nil, false
+	}
+	name = st.Title
+	if name == "" {
+		name = st.Kind + "-" + shortID(id)
+	}
+	return name, []*job{parent}, true
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// exportItems déplie les playlists et chaînes en leurs éléments; seuls les
+// fichiers des travaux terminés encore présents sur disque sont retenus.
+func exportItems(members []*job) []exportItem {
+	var items []exportItem
+	for _, j := range members {
+		st := j.snapshot()
+		if len(st.Children) > 0 {
+			var children []*job
+			for _, id := range st.Children {
+				if v, ok := jobs.Load(id); ok {
+					children = append(children, v.(*job))
+				}
+			}
+			items = append(items, exportItems(children)...)
+			continue
+		}
+		item := exportItem{Title: st.Title, URL: j.source(), Status: st.Status}
+		if st.Result != nil {
+			item.Duration = st.Result.Duration
+			if st.Status == "terminé" {
+				for _, f := range st.Result.Files {
+					if _, err := os.Stat(f); err == nil {
+						item.paths = append(item.paths, f)
+					} else {
+						item.Status = "fichier manquant"
+					}
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// addItemFiles range les fichiers d'un élément dans l'archive; plusieurs
+// fichiers (pistes par chapitre) vont dans un dossier au nom de l'élément.
+func addItemFiles(zw *zip.Writer, used map[string]bool, item *exportItem) error {
+	dir := ""
+	if len(item.paths) > 1 {
+		dir = sanitizeFileName(item.Title) + "/"
+	}
+	for _, p := range item.paths {
+		name := uniqueZipName(used, dir+filepath.Base(p))
+		if err := addZipFile(zw, name, p); err != nil {
+			return err
+		}
+		item.Files = append(item.Files, name)
+	}
+	return nil
+}
+
+// uniqueZipName numérote les homonymes, deux titres identiques ne devant
+// pas produire deux entrées de même nom dans l'archive.
+func uniqueZipName(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for n := 2; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+func addZipFile(zw *zip.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+func writeManifest(zw *zip.Writer, format string, items []exportItem) error {
+	var buf bytes.Buffer
+	if format == "json" {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(items); err != nil {
+			return err
+		}
+	} else {
+		cw := csv.NewWriter(&buf)
+		_ = cw.Write([]string{"titre", "url", "durée (s)", "statut", "fichiers"})
+		for _, item := range items {
+			duration := ""
+			if item.Duration > 0 {
+				duration = strconv.FormatFloat(item.Duration, 'f', 0, 64)
+			}
+			_ = cw.Write([]string{item.Title, item.URL, duration, item.Status, strings.Join(item.Files, "; ")})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	dst, err := zw.Create("manifeste." + format)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(buf.Bytes())
+	return err
+}
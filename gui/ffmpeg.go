@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var ffmpegPath string
+var ffprobePath string
+
+// locateTool cherche d'abord l'outil à côté de l'exécutable, puis dans le PATH.
+func locateTool(name string) string {
+	for _, candidate := range []string{name + ".exe", name} {
+		path := filepath.Join(baseDir, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return name
+}
+
+// runFFmpeg renvoie la sortie combinée de ffmpeg; en cas d'échec, l'erreur
+// reprend la dernière ligne affichée.
+func runFFmpeg(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, ffmpegPath, append([]string{"-hide_banner", "-nostdin", "-y"}, args...)...)
+	cmd.Dir = baseDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), ffmpegError(err, string(out))
+	}
+	return string(out), nil
+}
+
+func ffmpegError(err error, output string) error {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Errorf("ffmpeg: %s", last)
+	}
+	return fmt.Errorf("ffmpeg: %w", err)
+}
+
+// tempSibling donne un fichier temporaire voisin qui garde l'extension, afin
+// que ffmpeg choisisse le bon conteneur.
+func tempSibling(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".temp" + ext
+}
+
+// rewriteInPlace fait produire par ffmpeg une copie modifiée du fichier puis
+// remplace l'original; build reçoit le chemin temporaire de sortie.
+func rewriteInPlace(ctx context.Context, path string, build func(tmp string) []string) (string, error) {
+	tmp := tempSibling(path)
+	out, err := runFFmpeg(ctx, build(tmp)...)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return out, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return out, err
+	}
+	return out, nil
+}
+
+// writeTags remplace les étiquettes indiquées sans réencoder les flux;
+// la pochette éventuelle est conservée.
+func writeTags(ctx context.Context, path string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	_, err := rewriteInPlace(ctx, path, func(tmp string) []string {
+		args := []string{"-i", path, "-map", "0", "-c", "copy", "-map_metadata", "0"}
+		for _, key := range sortedKeys(tags) {
+			args = append(args, "-metadata", key+"="+tags[key])
+		}
+		return append(args, tmp)
+	})
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("ffmpeg introuvable, étiquettes non écrites")
+	}
+	return err
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Politiques appliquées quand le nom final d'un fichier est déjà pris.
+const (
+	collisionOverwrite = "overwrite"
+	collisionSkip      = "skip"
+	collisionSuffix    = "suffix"
+	collisionID        = "id"
+)
+
+const (
+	// maxFileNameBytes reste sous la limite de 255 octets des systèmes de
+	// fichiers courants, avec de la place pour un suffixe.
+	maxFileNameBytes = 200
+	// maxPathLength garde le chemin complet sous MAX_PATH (260) de Windows,
+	// en réservant de quoi loger les fichiers temporaires de ffmpeg.
+	maxPathLength    = 240
+	minFileNameBytes = 16
+	finalNameTimeout = 30 * time.Second
+	// stagingPrefix marque les fichiers d'un travail avant leur nom définitif.
+	stagingPrefix = "dl-"
+)
+
+var (
+	windowsReservedRe = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])$`)
+	templateFieldRe   = regexp.MustCompile(`%\(([a-z_]+)\)s`)
+	// templateAnyFieldRe reconnaît tout champ de modèle, formaté ou non
+	// (%(title).50s, %(upload_date>%Y)s, %(view_count)05d...).
+	templateAnyFieldRe = regexp.MustCompile(`%\([^)]*\)[-#0 +]*\d*(?:\.\d+)?[A-Za-z]`)
+	spaceRunRe         = regexp.MustCompile(`\s+`)
+	dashRunRe          = regexp.MustCompile(` (?:- )+`)
+)
+
+func validateCollision(policy string) (string, error) {
+	switch policy = strings.ToLower(strings.TrimSpace(policy)); policy {
+	case "":
+		return collisionSuffix, nil
+	case collisionOverwrite, collisionSkip, collisionSuffix, collisionID:
+		return policy, nil
+	}
+	return "", fmt.Errorf("politique de collision %q inconnue (overwrite, skip, suffix ou id)", policy)
+}
+
+// sanitizeFileName rend un titre utilisable comme nom de fichier sous
+// Windows comme ailleurs: caractères interdits remplacés, émojis et
+// caractères invisibles retirés, points et espaces de bord supprimés, noms
+// réservés (CON, NUL...) évités, longueur plafonnée à maxFileNameBytes.
+func sanitizeFileName(name string) string {
+	return truncateFileName(cleanFileName(name), maxFileNameBytes)
+}
+
+func cleanFileName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == ':' || r == '/' || r == '\\' || r == '|':
+			b.WriteString(" - ")
+		case strings.ContainsRune(`<>"?*`, r):
+			// retiré
+		case r < 32 || r == 0x7f || r == utf8.RuneError:
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Cf, r), unicode.Is(unicode.Co, r), unicode.Is(unicode.Cs, r):
+		case r >= 0xfe00 && r <= 0xfe0f, r >= 0x1f3fb && r <= 0x1f3ff:
+			// sélecteurs de variante et tons de peau qui accompagnent les émojis
+		default:
+			b.WriteRune(r)
+		}
+	}
+	clean := spaceRunRe.ReplaceAllString(b.String(), " ")
+	clean = dashRunRe.ReplaceAllString(clean, " - ")
+	clean = trimFileName(clean)
+	stem := clean
+	if i := strings.Index(stem, "."); i >= 0 {
+		stem = stem[:i]
+	}
+	if windowsReservedRe.MatchString(strings.TrimSpace(stem)) {
+		clean = "_" + clean
+	}
+	if clean == "" {
+		return "sans titre"
+	}
+	return clean
+}
+
+func trimFileName(name string) string {
+	return strings.Trim(name, ". - \t")
+}
+
+// truncateFileName coupe sans casser de caractère UTF-8.
+func truncateFileName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	if trimmed := trimFileName(name[:cut]); trimmed != "" {
+		return trimmed
+	}
+	return name[:cut]
+}
+
+// fitFileName assemble base et extension dans dir en respectant à la fois
+// la longueur maximale d'un nom et celle du chemin complet; reserve laisse
+// la place d'un suffixe ajouté ensuite.
+func fitFileName(dir, base, ext string, reserve int) string {
+	limit := maxPathLength - len(dir) - 1 - len(ext) - reserve
+	if limit > maxFileNameBytes {
+		limit = maxFileNameBytes
+	}
+	if limit < minFileNameBytes {
+		limit = minFileNameBytes
+	}
+	return filepath.Join(dir, truncateFileName(cleanFileName(base), limit)+ext)
+}
+
+// stagingTemplate remplace le nom de fichier du modèle de sortie par un nom
+// propre au travail; les dossiers du modèle sont conservés. Le nom définitif
+// est choisi par finalizeOutput, une fois le téléchargement terminé.
+func stagingTemplate(args []string, jobID string) []string {
+	out := append([]string(nil), args...)
+	for i := 0; i+1 < len(out); i++ {
+		if out[i] == "-o" {
+			dir, _ := splitTemplate(out[i+1])
+			out[i+1] = dir + stagingPrefix + jobID + ".%(ext)s"
+			break
+		}
+	}
+	return out
+}
+
+// splitTemplate sépare les dossiers du modèle de son dernier composant.
+func splitTemplate(tmpl string) (dir, base string) {
+	i := strings.LastIndexAny(tmpl, `/\`)
+	return tmpl[:i+1], tmpl[i+1:]
+}
+
+// resolveFinalName fait calculer par le téléchargeur, d'après le fichier
+// d'informations qu'il vient d'écrire, le nom (sans extension) que donne le
+// modèle de sortie du préréglage: champs formatés, dates et valeurs par
+// défaut sont ainsi interprétés comme lors d'un téléchargement direct. Un
+// échec renvoie une chaîne vide et laisse finalName prendre le relais.
+func resolveFinalName(ctx context.Context, job *job) string {
+	job.mu.RLock()
+	path := job.infoPath
+	job.mu.RUnlock()
+	if path == "" {
+		return ""
+	}
+	_, base := splitTemplate(outputTemplate(job.preset))
+	ctx, cancel := context.WithTimeout(ctx, finalNameTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ytdlPath, "--load-info-json", path, "--get-filename", "-o", base)
+	cmd.Dir = baseDir
+	out, err := cmd.Output()
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	name := strings.TrimSpace(lines[len(lines)-1])
+	if err != nil || name == "" {
+		job.appendLog(fmt.Sprintf("Nom définitif calculé sans le téléchargeur: %v", err))
+		return ""
+	}
+	if strings.HasSuffix(base, ".%(ext)s") {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// finalName déduit du modèle de sortie du préréglage le nom définitif (sans
+// extension) quand seuls des champs simples y figurent; exact vaut false, et
+// le nom de repli est renvoyé, si le modèle demande davantage (champs
+// formatés ou inconnus), que seul le téléchargeur sait interpréter.
+func finalName(p preset, info *videoInfo, fallback string) (name string, exact bool) {
+	_, base := splitTemplate(outputTemplate(p))
+	base = strings.TrimSuffix(base, ".%(ext)s")
+	if info == nil {
+		return fallback, false
+	}
+	fields := map[string]string{
+		"title":       info.Title,
+		"id":          info.ID,
+		"uploader":    info.Uploader,
+		"channel":     info.Channel,
+		"artist":      info.Artist,
+		"track":       info.Track,
+		"album":       info.Album,
+		"upload_date": info.UploadDate,
+		"ext":         info.Ext,
+	}
+	exact = true
+	name = templateAnyFieldRe.ReplaceAllStringFunc(base, func(m string) string {
+		sub := templateFieldRe.FindStringSubmatch(m)
+		if sub == nil || sub[0] != m {
+			exact = false
+			return m
+		}
+		if v, ok := fields[sub[1]]; ok && v != "" {
+			return v
+		}
+		if _, ok := fields[sub[1]]; !ok {
+			exact = false
+		}
+		return "NA"
+	})
+	if !exact || strings.TrimSpace(name) == "" || name == "NA" {
+		return fallback, exact
+	}
+	return name, true
+}
+
+// resolveCollision choisit le chemin définitif selon la politique; skip
+// vaut true quand le fichier existant doit être conservé tel quel.
+func resolveCollision(target, policy, videoID string) (path string, skip bool) {
+	if _, err := os.Stat(target); err != nil {
+		return target, false
+	}
+	switch policy {
+	case collisionOverwrite:
+		return target, false
+	case collisionSkip:
+		return target, true
+	}
+	ext := filepath.Ext(target)
+	stem := strings.TrimSuffix(target, ext)
+	if policy == collisionID && videoID != "" {
+		candidate := fmt.Sprintf("%s [%s]%s", stem, videoID, ext)
+		if _, err := os.Stat(candidate); err != nil {
+			return candidate, false
+		}
+		stem = strings.TrimSuffix(candidate, ext)
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		if _, err := os.Stat(candidate); err != nil {
+			return candidate, false
+		}
+	}
+}
+
+// existingOutput renvoie, pour la politique skip, le fichier déjà présent
+// sous le nom que prendrait le téléchargement; le titre doit être connu
+// d'avance et le dossier du modèle ne pas dépendre de la vidéo.
+func existingOutput(job *job, url string) string {
+	if job.opts.Collision != collisionSkip {
+		return ""
+	}
+	info := cachedVideoInfo(url)
+	dir, _ := splitTemplate(outputTemplate(job.preset))
+	if info == nil || strings.Contains(dir, "%(") {
+		return ""
+	}
+	name, exact := finalName(job.preset, info, info.Title)
+	if !exact {
+		return ""
+	}
+	target := fitFileName(resolveOutput(filepath.Clean(dir)), name, "."+expectedExtension(job.preset), 0)
+	if _, err := os.Stat(target); err != nil {
+		return ""
+	}
+	return target
+}
+
+// finalizeOutput renomme les fichiers produits sous leur nom définitif,
+// sous-titres compris, en appliquant la politique de collision du travail.
+func finalizeOutput(job *job, info *videoInfo, result *jobResult) error {
+	if len(result.Files) == 0 {
+		return nil
+	}
+	staged := result.Files[0]
+	base := filepath.Base(staged)
+	if !strings.HasPrefix(base, stagingPrefix) {
+		return nil
+	}
+	ext := filepath.Ext(staged)
+	stagedStem := strings.TrimSuffix(staged, ext)
+	title := job.snapshot().Title
+	if title == "" {
+		title = strings.TrimSuffix(base, ext)
+	}
+	videoID := ""
+	if info != nil {
+		videoID = info.ID
+	}
+	policy := job.opts.Collision
+	reserve := 0
+	if policy == collisionSuffix || policy == collisionID {
+		reserve = len(videoID) + 8
+	}
+	name := result.finalBase
+	if name == "" {
+		name, _ = finalName(job.preset, info, title)
+	}
+	target := fitFileName(filepath.Dir(staged), name, ext, reserve)
+	target, skip := resolveCollision(target, policy, videoID)
+	if skip {
+		job.appendLog(fmt.Sprintf("%s existe déjà, fichier existant conservé", filepath.Base(target)))
+		if err := os.Remove(staged); err != nil {
+			job.appendLog(fmt.Sprintf("Fichier téléchargé non supprimé: %v", err))
+		}
+		result.Files[0] = target
+		result.Skipped = true
+	} else {
+		if err := os.Rename(staged, target); err != nil {
+			return fmt.Errorf("renommage en %s: %w", filepath.Base(target), err)
+		}
+		result.Files[0] = target
+	}
+	finalStem := strings.TrimSuffix(target, ext)
+	var subtitles []string
+	for _, sub := range result.Subtitles {
+		switch {
+		case !strings.HasPrefix(sub, stagedStem+"."):
+			subtitles = append(subtitles, sub)
+		case skip:
+			_ = os.Remove(sub)
+		default:
+			renamed := finalStem + strings.TrimPrefix(sub, stagedStem)
+			if err := os.Rename(sub, renamed); err != nil {
+				job.appendLog(fmt.Sprintf("Sous-titres non renommés: %v", err))
+				renamed = sub
+			}
+			subtitles = append(subtitles, renamed)
+		}
+	}
+	result.Subtitles = subtitles
+	job.setOutput(result.Files[0])
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestFinalName(t *testing.T) {
+	info := &videoInfo{ID: "dQw4w9WgXcQ", Title: "Titre", Uploader: "Chaîne", UploadDate: "20240102", Ext: "mp4"}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		exact    bool
+	}{
+		{name: "défaut", template: "", want: "Titre", exact: true},
+		{name: "champs simples", template: "%(uploader)s - %(title)s [%(id)s].%(ext)s", want: "Chaîne - Titre [dQw4w9WgXcQ]", exact: true},
+		{name: "dossier ignoré", template: "%(uploader)s/%(title)s.%(ext)s", want: "Titre", exact: true},
+		{name: "champ vide", template: "%(artist)s - %(title)s.%(ext)s", want: "NA - Titre", exact: true},
+		{name: "champ tronqué", template: "%(title).50s.%(ext)s", want: "repli", exact: false},
+		{name: "date formatée", template: "%(upload_date>%Y)s - %(title)s.%(ext)s", want: "repli", exact: false},
+		{name: "champ inconnu", template: "%(playlist_index)s - %(title)s.%(ext)s", want: "repli", exact: false},
+		{name: "nombre formaté", template: "%(view_count)05d.%(ext)s", want: "repli", exact: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exact := finalName(preset{OutputTemplate: tt.template}, info, "repli")
+			if got != tt.want || exact != tt.exact {
+				t.Errorf("finalName(%q) = %q, %v; attendu %q, %v", tt.template, got, exact, tt.want, tt.exact)
+			}
+		})
+	}
+}
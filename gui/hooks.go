@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultHookTimeout = 2 * time.Minute
+
+// hookConfig décrit une commande lancée sur chaque fichier produit. Les
+// arguments acceptent les marqueurs {file}, {dir}, {name}, {title}, {id},
+// {mode} et {preset}.
+type hookConfig struct {
+	Name           string   `json:"name"`
+	Command        string   `json:"command"`
+	Args           []string `json:"args"`
+	TimeoutSeconds int      `json:"timeoutSeconds"`
+	FailJob        bool     `json:"failJob"`
+	Modes          []string `json:"modes,omitempty"`
+}
+
+var hooks []hookConfig
+
+func loadHooks(configured []hookConfig) []hookConfig {
+	var list []hookConfig
+	for _, h := range configured {
+		if strings.TrimSpace(h.Command) == "" {
+			log.Printf("Hook %q ignoré: commande manquante\n", h.Name)
+			continue
+		}
+		if h.Name == "" {
+			h.Name = filepath.Base(h.Command)
+		}
+		list = append(list, h)
+	}
+	return list
+}
+
+func (h hookConfig) appliesTo(mode string) bool {
+	if len(h.Modes) == 0 {
+		return true
+	}
+	for _, m := range h.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func (h hookConfig) timeout() time.Duration {
+	if h.TimeoutSeconds <= 0 {
+		return defaultHookTimeout
+	}
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+// runHooks exécute les hooks configurés sur chaque fichier du résultat; seul
+// l'échec d'un hook marqué failJob fait échouer le travail.
+func runHooks(ctx context.Context, job *job, result *jobResult) error {
+	status := job.snapshot()
+	for _, h := range hooks {
+		if !h.appliesTo(status.Mode) {
+			continue
+		}
+		for _, file := range result.Files {
+			job.update(func(s *jobStatus) { s.Status = "hooks" })
+			job.appendLog(fmt.Sprintf("Hook %s: %s", h.Name, filepath.Base(file)))
+			err := runHook(ctx, job, h, hookValues(status, file))
+			if err == nil {
+				continue
+			}
+			if h.FailJob {
+				return fmt.Errorf("hook %s: %w", h.Name, err)
+			}
+			job.appendLog(fmt.Sprintf("Hook %s en échec (ignoré): %v", h.Name, err))
+		}
+	}
+	return nil
+}
+
+func hookValues(status jobStatus, file string) map[string]string {
+	return map[string]string{
+		"{file}":   file,
+		"{dir}":    filepath.Dir(file),
+		"{name}":   filepath.Base(file),
+		"{title}":  status.Title,
+		"{id}":     status.ID,
+		"{mode}":   status.Mode,
+		"{preset}": status.Preset,
+	}
+}
+
+func runHook(ctx context.Context, job *job, h hookConfig, values map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+
+	pairs := make([]string, 0, len(values)*2)
+	for k, v := range values {
+		pairs = append(pairs, k, v)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	args := make([]string, len(h.Args))
+	for i, a := range h.Args {
+		args[i] = replacer.Replace(a)
+	}
+
+	cmd := exec.CommandContext(ctx, h.Command, args...)
+	cmd.Dir = baseDir
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	streamLines(job, bufio.NewReader(out), "["+h.Name+"] ")
+	err = cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("délai de %s dépassé", h.timeout())
+	}
+	return err
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const infoTimeout = 90 * time.Second
+
+var formatIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]+(?:\+[A-Za-z0-9_-]+)*$`)
+
+// videoInfo reprend les champs du JSON d'informations du téléchargeur dont l'application se sert.
+type videoInfo struct {
+	ID               string       `json:"id"`
+	Title            string       `json:"title"`
+	Artist           string       `json:"artist"`
+	Track            string       `json:"track"`
+	Album            string       `json:"album"`
+	Uploader         string       `json:"uploader"`
+	Channel          string       `json:"channel"`
+	Duration         float64      `json:"duration"`
+	Thumbnail        string       `json:"thumbnail"`
+	UploadDate       string       `json:"upload_date"`
+	ViewCount        int64        `json:"view_count"`
+	Filesize         int64        `json:"filesize"`
+	FilesizeApprox   int64        `json:"filesize_approx"`
+	TBR              float64      `json:"tbr"`
+	Ext              string       `json:"ext"`
+	FormatID         string       `json:"format_id"`
+	Height           int          `json:"height"`
+	FPS              float64      `json:"fps"`
+	VCodec           string       `json:"vcodec"`
+	ACodec           string       `json:"acodec"`
+	ABR              float64      `json:"abr"`
+	DynamicRange     string       `json:"dynamic_range"`
+	RequestedFormats []formatInfo `json:"requested_formats"`
+	Formats          []formatInfo `json:"formats"`
+	Chapters         []chapter    `json:"chapters"`
+
+	SponsorblockChapters []sponsorSegment `json:"sponsorblock_chapters"`
+
+	Subtitles         map[string][]subtitleTrack `json:"subtitles"`
+	AutomaticCaptions map[string][]subtitleTrack `json:"automatic_captions"`
+}
+
+type formatInfo struct {
+	FormatID       string  `json:"format_id"`
+	FormatNote     string  `json:"format_note"`
+	Ext            string  `json:"ext"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	FPS            float64 `json:"fps"`
+	VCodec         string  `json:"vcodec"`
+	ACodec         string  `json:"acodec"`
+	ABR            float64 `json:"abr"`
+	TBR            float64 `json:"tbr"`
+	Filesize       int64   `json:"filesize"`
+	FilesizeApprox int64   `json:"filesize_approx"`
+	DynamicRange   string  `json:"dynamic_range"`
+}
+
+// formatEntry est la forme publique d'un format proposé au choix manuel.
+type formatEntry struct {
+	ID         string  `json:"id"`
+	Container  string  `json:"container"`
+	VCodec     string  `json:"vcodec,omitempty"`
+	ACodec     string  `json:"acodec,omitempty"`
+	Resolution string  `json:"resolution,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FPS        float64 `json:"fps,omitempty"`
+	Bitrate    float64 `json:"bitrate,omitempty"`
+	Size       int64   `json:"size,omitempty"`
+	AudioOnly  bool    `json:"audioOnly"`
+	VideoOnly  bool    `json:"videoOnly"`
+	Note       string  `json:"note,omitempty"`
+}
+
+// videoSummary est l'aperçu renvoyé par /info avant un téléchargement.
+type videoSummary struct {
+	ID            string  `json:"id"`
+	Title         string  `json:"title"`
+	Channel       string  `json:"channel"`
+	Duration      float64 `json:"duration"`
+	Thumbnail     string  `json:"thumbnail,omitempty"`
+	UploadDate    string  `json:"uploadDate,omitempty"`
+	ViewCount     int64   `json:"viewCount"`
+	EstimatedSize int64   `json:"estimatedSize,omitempty"`
+
+	Subtitles    []string `json:"subtitles"`
+	AutoCaptions []string `json:"autoCaptions"`
+}
+
+type infoResponse struct {
+	OK    bool          `json:"ok"`
+	Info  *videoSummary `json:"info,omitempty"`
+	Error string        `json:"error,omitempty"`
+	Code  string        `json:"code,omitempty"`
+}
+
+type formatsResponse struct {
+	OK      bool          `json:"ok"`
+	Formats []formatEntry `json:"formats,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Code    string        `json:"code,omitempty"`
+}
+
+// qualityInfo décrit la qualité réellement retenue par le téléchargeur.
+type qualityInfo struct {
+	FormatID     string  `json:"formatId"`
+	Resolution   string  `json:"resolution,omitempty"`
+	Height       int     `json:"height,omitempty"`
+	FPS          float64 `json:"fps,omitempty"`
+	VCodec       string  `json:"vcodec,omitempty"`
+	ACodec       string  `json:"acodec,omitempty"`
+	AudioBitrate float64 `json:"audioBitrate,omitempty"`
+	DynamicRange string  `json:"dynamicRange,omitempty"`
+	Summary      string  `json:"summary"`
+}
+
+// dumpVideoInfo interroge le téléchargeur en mode JSON, sans rien télécharger.
+func dumpVideoInfo(ctx context.Context, url string) (*videoInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, infoTimeout)
+	defer cancel()
+	var info videoInfo
+	if err := dumpJSON(ctx, &info, "-J", "--no-playlist", url); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func dumpJSON(ctx context.Context, v interface{}, args ...string) error {
+	cmd := exec.CommandContext(ctx, ytdlPath, args...)
+	cmd.Dir = baseDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return ytdlError(err, stderr.String())
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("réponse du téléchargeur illisible: %w", err)
+	}
+	return nil
+}
+
+// ytdlError privilégie la dernière ligne ERROR: du téléchargeur, plus parlante que le code de sortie.
+func ytdlError(err error, stderr string) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); strings.HasPrefix(line, "ERROR:") {
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+		}
+	}
+	return err
+}
+
+func infoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	raw := r.URL.Query().Get("url")
+	if strings.TrimSpace(raw) == "" {
+		http.Error(w, "URL manquante", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	u, err := policy.check(raw)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(infoResponse{OK: false, Error: err.Error(), Code: policyCode(err)})
+		return
+	}
+	info, err := fetchVideoInfo(r.Context(), u.Normalized)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(infoResponse{OK: false, Error: err.Error()})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(infoResponse{OK: true, Info: info.summary()})
+}
+
+func (info *videoInfo) summary() *videoSummary {
+	s := &videoSummary{
+		ID:            info.ID,
+		Title:         info.Title,
+		Channel:       info.Channel,
+		Duration:      info.Duration,
+		Thumbnail:     info.Thumbnail,
+		ViewCount:     info.ViewCount,
+		EstimatedSize: info.estimatedSize(),
+		Subtitles:     subtitleLanguages(info.Subtitles),
+		AutoCaptions:  subtitleLanguages(info.AutomaticCaptions),
+	}
+	if s.Channel == "" {
+		s.Channel = info.Uploader
+	}
+	if d, err := time.Parse("20060102", info.UploadDate); err == nil {
+		s.UploadDate = d.Format("2006-01-02")
+	}
+	return s
+}
+
+// estimatedSize additionne les flux retenus par défaut; à défaut de taille
+// annoncée, elle se déduit du débit moyen et de la durée.
+func (info *videoInfo) estimatedSize() int64 {
+	var total int64
+	for _, f := range info.RequestedFormats {
+		if f.Filesize > 0 {
+			total += f.Filesize
+		} else {
+			total += f.FilesizeApprox
+		}
+	}
+	if total > 0 {
+		return total
+	}
+	if info.Filesize > 0 {
+		return info.Filesize
+	}
+	if info.FilesizeApprox > 0 {
+		return info.FilesizeApprox
+	}
+	return int64(info.TBR * 1000 / 8 * info.Duration)
+}
+
+func formatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	raw := r.URL.Query().Get("url")
+	if strings.TrimSpace(raw) == "" {
+		http.Error(w, "URL manquante", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	u, err := policy.check(raw)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(formatsResponse{OK: false, Error: err.Error(), Code: policyCode(err)})
+		return
+	}
+	info, err := fetchVideoInfo(r.Context(), u.Normalized)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(formatsResponse{OK: false, Error: err.Error()})
+		return
+	}
+	entries := make([]formatEntry, 0, len(info.Formats))
+	for _, f := range info.Formats {
+		entries = append(entries, f.entry())
+	}
+	_ = json.NewEncoder(w).Encode(formatsResponse{OK: true, Formats: entries})
+}
+
+func (f formatInfo) entry() formatEntry {
+	e := formatEntry{
+		ID:        f.FormatID,
+		Container: f.Ext,
+		Width:     f.Width,
+		Height:    f.Height,
+		FPS:       f.FPS,
+		Bitrate:   f.TBR,
+		Size:      f.Filesize,
+		Note:      f.FormatNote,
+	}
+	if e.Size == 0 {
+		e.Size = f.FilesizeApprox
+	}
+	hasVideo := f.VCodec != "" && f.VCodec != "none"
+	hasAudio := f.ACodec != "" && f.ACodec != "none"
+	if hasVideo {
+		e.VCodec = f.VCodec
+	}
+	if hasAudio {
+		e.ACodec = f.ACodec
+	}
+	e.AudioOnly = hasAudio && !hasVideo
+	e.VideoOnly = hasVideo && !hasAudio
+	if f.Height > 0 {
+		e.Resolution = fmt.Sprintf("%dx%d", f.Width, f.Height)
+	}
+	return e
+}
+
+// applyFormatID impose un identifiant de format choisi manuellement (ex. "137+140").
+func applyFormatID(p *preset, id string) error {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil
+	}
+	if !formatIDRe.MatchString(id) {
+		return fmt.Errorf("identifiant de format %q invalide", id)
+	}
+	p.Format = id
+	p.MaxHeight, p.VideoCodec, p.MaxFPS, p.HDR = 0, "", 0, ""
+	return nil
+}
+
+func readInfoJSON(path string) (*videoInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info videoInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("informations %s illisibles: %w", path, err)
+	}
+	return &info, nil
+}
+
+// quality résume la qualité du format retenu, sans modifier info.
+func (info *videoInfo) quality() *qualityInfo {
+	q := &qualityInfo{
+		FormatID:     info.FormatID,
+		Height:       info.Height,
+		FPS:          info.FPS,
+		VCodec:       info.VCodec,
+		ACodec:       info.ACodec,
+		AudioBitrate: info.ABR,
+		DynamicRange: info.DynamicRange,
+	}
+	// Pour un format fusionné, les caractéristiques sont portées par les flux demandés.
+	for _, f := range info.RequestedFormats {
+		if f.VCodec != "" && f.VCodec != "none" {
+			q.Height, q.FPS, q.VCodec, q.DynamicRange = f.Height, f.FPS, f.VCodec, f.DynamicRange
+		}
+		if f.ACodec != "" && f.ACodec != "none" {
+			q.ACodec, q.AudioBitrate = f.ACodec, f.ABR
+		}
+	}
+	if q.VCodec == "none" {
+		q.VCodec = ""
+	}
+	if q.ACodec == "none" {
+		q.ACodec = ""
+	}
+
+	var parts []string
+	if q.Height > 0 {
+		q.Resolution = fmt.Sprintf("%dp", q.Height)
+		if q.FPS > 30 {
+			q.Resolution += fmt.Sprintf("%.0f", q.FPS)
+		}
+		parts = append(parts, q.Resolution)
+	}
+	if q.VCodec != "" {
+		parts = append(parts, q.VCodec)
+	}
+	if q.DynamicRange != "" && q.DynamicRange != "SDR" {
+		parts = append(parts, q.DynamicRange)
+	}
+	if q.ACodec != "" {
+		audio := q.ACodec
+		if q.AudioBitrate > 0 {
+			audio += fmt.Sprintf(" %.0fk", q.AudioBitrate)
+		}
+		parts = append(parts, audio)
+	}
+	q.Summary = strings.Join(parts, " · ")
+	return q
+}
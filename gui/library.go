@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxLibraryDepth = 4
+	probeTimeout    = 15 * time.Second
+	// minRescanInterval espace les parcours déclenchés par un identifiant inconnu.
+	minRescanInterval = 30 * time.Second
+)
+
+// libraryConfig liste les dossiers parcourus par la bibliothèque, en plus du
+// dossier de téléchargement, toujours indexé.
+type libraryConfig struct {
+	Folders []libraryFolder `json:"folders"`
+}
+
+type libraryFolder struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+var mediaExtensions = map[string]string{
+	".mp4": "video", ".mkv": "video", ".webm": "video", ".mov": "video", ".avi": "video", ".flv": "video", ".m4v": "video",
+	".mp3": "audio", ".m4a": "audio", ".aac": "audio", ".opus": "audio", ".ogg": "audio", ".flac": "audio", ".wav": "audio",
+}
+
+// libraryItem décrit un fichier multimédia présent dans un dossier de la bibliothèque.
+type libraryItem struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Folder     string    `json:"folder"`
+	RelPath    string    `json:"relPath"`
+	Path       string    `json:"-"`
+	Kind       string    `json:"kind"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	Duration   float64   `json:"duration,omitempty"`
+	VideoCodec string    `json:"videoCodec,omitempty"`
+	AudioCodec string    `json:"audioCodec,omitempty"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	Title      string    `json:"title,omitempty"`
+	JobID      string    `json:"jobId,omitempty"`
+	SourceURL  string    `json:"sourceUrl,omitempty"`
+}
+
+// mediaProbe garde le résultat de ffprobe tant que le fichier n'a pas changé.
+type mediaProbe struct {
+	Size       int64
+	ModTime    time.Time
+	Kind       string
+	Duration   float64
+	VideoCodec string
+	AudioCodec string
+	Width      int
+	Height     int
+}
+
+type mediaLibrary struct {
+	mu      sync.Mutex
+	folders []libraryFolder
+	probes  map[string]mediaProbe
+	items   map[string]libraryItem
+	// scannedAt date le dernier parcours (ou celui en cours).
+	scannedAt time.Time
+}
+
+var library *mediaLibrary
+
+// newMediaLibrary indexe les dossiers configurés; le dossier de
+// téléchargement en fait toujours partie, pour que les nouveaux fichiers
+// apparaissent dans la bibliothèque et puissent en être déplacés.
+func newMediaLibrary(c libraryConfig, dir string) *mediaLibrary {
+	lib := &mediaLibrary{probes: make(map[string]mediaProbe), items: make(map[string]libraryItem)}
+	downloads := libraryFolder{Name: "Téléchargements", Path: filepath.Clean(dir)}
+	var folders []libraryFolder
+	for _, f := range c.Folders {
+		if strings.TrimSpace(f.Path) == "" {
+			log.Printf("Dossier de bibliothèque %q ignoré: chemin manquant\n", f.Name)
+			continue
+		}
+		if !filepath.IsAbs(f.Path) {
+			f.Path = filepath.Join(dir, f.Path)
+		}
+		f.Path = filepath.Clean(f.Path)
+		if f.Name == "" {
+			f.Name = filepath.Base(f.Path)
+		}
+		if f.Path == downloads.Path {
+			downloads.Name = f.Name
+			continue
+		}
+		folders = append(folders, f)
+	}
+	seen := map[string]bool{downloads.Name: true}
+	lib.folders = []libraryFolder{downloads}
+	for _, f := range folders {
+		if seen[f.Name] {
+			log.Printf("Dossier de bibliothèque %q ignoré: nom déjà utilisé\n", f.Name)
+			continue
+		}
+		seen[f.Name] = true
+		lib.folders = append(lib.folders, f)
+	}
+	return lib
+}
+
+// walkFiles appelle fn pour chaque fichier de root, jusqu'à maxLibraryDepth
+// niveaux, sans entrer dans les dossiers cachés (dont la corbeille).
+func walkFiles(root string, fn func(path string, d fs.DirEntry)) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			fn(path, d)
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if path != root && (strings.HasPrefix(d.Name(), ".") || strings.Count(rel, string(filepath.Separator)) >= maxLibraryDepth) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func libraryID(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// scan parcourt les dossiers et sonde les fichiers nouveaux ou modifiés;
+// l'origine (travail, URL) vient de l'archive des téléchargements.
+func (l *mediaLibrary) scan(ctx context.Context) []libraryItem {
+	sources := archive.byFile()
+	var items []libraryItem
+	for _, folder := range l.folders {
+		root := folder
+		walkFiles(root.Path, func(path string, d fs.DirEntry) {
+			kind, ok := mediaExtensions[strings.ToLower(filepath.Ext(path))]
+			if !ok || strings.Contains(d.Name(), ".temp.") {
+				return
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return
+			}
+			rel, _ := filepath.Rel(root.Path, path)
+			item := libraryItem{
+				ID:      libraryID(path),
+				Name:    d.Name(),
+				Folder:  root.Name,
+				RelPath: filepath.ToSlash(rel),
+				Path:    path,
+				Kind:    kind,
+				Size:    fi.Size(),
+				ModTime: fi.ModTime(),
+			}
+			l.applyProbe(ctx, &item)
+			if entry, ok := sources[path]; ok {
+				item.Title, item.JobID, item.SourceURL = entry.Title, entry.JobID, entry.URL
+			}
+			items = append(items, item)
+		})
+	}
+	index := make(map[string]libraryItem, len(items))
+	for _, item := range items {
+		index[item.ID] = item
+	}
+	l.mu.Lock()
+	l.items = index
+	l.scannedAt = time.Now()
+	for path := range l.probes {
+		if _, ok := index[libraryID(path)]; !ok {
+			delete(l.probes, path)
+		}
+	}
+	l.mu.Unlock()
+	return items
+}
+
+func (l *mediaLibrary) applyProbe(ctx context.Context, item *libraryItem) {
+	l.mu.Lock()
+	p, ok := l.probes[item.Path]
+	l.mu.Unlock()
+	if !ok || p.Size != item.Size || !p.ModTime.Equal(item.ModTime) {
+		probed, err := probeMedia(ctx, item.Path)
+		if err != nil {
+			log.Printf("ffprobe %s: %v\n", item.Path, err)
+			return
+		}
+		p = *probed
+		p.Size, p.ModTime = item.Size, item.ModTime
+		l.mu.Lock()
+		l.probes[item.Path] = p
+		l.mu.Unlock()
+	}
+	if p.Kind != "" {
+		item.Kind = p.Kind
+	}
+	item.Duration, item.VideoCodec, item.AudioCodec, item.Width, item.Height = p.Duration, p.VideoCodec, p.AudioCodec, p.Width, p.Height
+}
+
+// lookup retrouve un fichier dans l'index, indexé au démarrage puis tenu à
+// jour par /library et après chaque modification. Un identifiant inconnu ne
+// provoque un nouveau parcours que si le dernier date de minRescanInterval.
+func (l *mediaLibrary) lookup(ctx context.Context, id string) (libraryItem, bool) {
+	l.mu.Lock()
+	item, ok := l.items[id]
+	stale := time.Since(l.scannedAt) >= minRescanInterval
+	if !ok && stale {
+		l.scannedAt = time.Now()
+	}
+	l.mu.Unlock()
+	if ok || !stale {
+		return item, ok
+	}
+	l.scan(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	item, ok = l.items[id]
+	return item, ok
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType   string `json:"codec_type"`
+		CodecName   string `json:"codec_name"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probeMedia lit durée, codecs et définition; une pochette intégrée ne fait
+// pas d'un fichier audio une vidéo.
+func probeMedia(ctx context.Context, path string) (*mediaProbe, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ffprobePath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var parsed ffprobeOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("sortie ffprobe illisible: %w", err)
+	}
+	p := &mediaProbe{Kind: "audio"}
+	p.Duration, _ = strconv.ParseFloat(parsed.Format.Duration, 64)
+	for _, s := range parsed.Streams {
+		switch {
+		case s.CodecType == "video" && s.Disposition.AttachedPic == 0 && p.VideoCodec == "":
+			p.Kind, p.VideoCodec, p.Width, p.Height = "video", s.CodecName, s.Width, s.Height
+		case s.CodecType == "audio" && p.AudioCodec == "":
+			p.AudioCodec = s.CodecName
+		}
+	}
+	return p, nil
+}
+
+type libraryResponse struct {
+	OK      bool          `json:"ok"`
+	Items   []libraryItem `json:"items,omitempty"`
+	Folders []string      `json:"folders,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// libraryHandler liste la bibliothèque: q filtre nom, titre et dossier, kind
+// restreint à audio ou video, sort vaut date, name, size ou duration.
+func libraryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	items := filterLibrary(library.scan(r.Context()), q.Get("q"), q.Get("kind"))
+	if err := sortLibrary(items, q.Get("sort"), q.Get("order")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	folders := make([]string, 0, len(library.folders))
+	for _, f := range library.folders {
+		folders = append(folders, f.Name)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(libraryResponse{OK: true, Items: items, Folders: folders})
+}
+
+func filterLibrary(items []libraryItem, query, kind string) []libraryItem {
+	terms := strings.Fields(strings.ToLower(query))
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	var out []libraryItem
+	for _, item := range items {
+		if kind != "" && item.Kind != kind {
+			continue
+		}
+		haystack := strings.ToLower(item.Name + " " + item.Title + " " + item.Folder)
+		match := true
+		for _, t := range terms {
+			if !strings.Contains(haystack, t) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func sortLibrary(items []libraryItem, key, order string) error {
+	var less func(a, b libraryItem) bool
+	switch key {
+	case "", "date":
+		less = func(a, b libraryItem) bool { return a.ModTime.Before(b.ModTime) }
+	case "name":
+		less = func(a, b libraryItem) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "size":
+		less = func(a, b libraryItem) bool { return a.Size < b.Size }
+	case "duration":
+		less = func(a, b libraryItem) bool { return a.Duration < b.Duration }
+	default:
+		return fmt.Errorf("tri %q inconnu", key)
+	}
+	desc := order == "desc" || (order == "" && (key == "" || key == "date"))
+	sort.SliceStable(items, func(i, j int) bool {
+		if desc {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+	return nil
+}
+
+// libraryFileHandler sert GET /library/file/{id}; ServeContent gère les
+// requêtes Range, nécessaires pour avancer dans la lecture côté navigateur.
+func libraryFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/library/file/"), "/")
+	item, ok := library.lookup(r.Context(), id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(item.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, item.Name, fi.ModTime(), f)
+}
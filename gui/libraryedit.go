@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	trashDirName      = ".corbeille"
+	trashManifestName = "corbeille.json"
+)
+
+// errFileExists signale qu'une opération écraserait un fichier existant.
+var errFileExists = errors.New("un fichier du même nom existe déjà")
+
+// trashMu sérialise les mises à jour du manifeste de la corbeille.
+var trashMu sync.Mutex
+
+type libraryActionRequest struct {
+	ID     string          `json:"id"`
+	Name   string          `json:"name"`
+	Folder string          `json:"folder"`
+	Tags   *libraryTagEdit `json:"tags"`
+}
+
+// libraryTagEdit ne modifie que les champs présents; une chaîne vide efface l'étiquette.
+type libraryTagEdit struct {
+	Title  *string `json:"title"`
+	Artist *string `json:"artist"`
+	Album  *string `json:"album"`
+}
+
+type libraryActionResponse struct {
+	OK    bool         `json:"ok"`
+	Item  *libraryItem `json:"item,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+type trashResponse struct {
+	OK      bool         `json:"ok"`
+	Entries []trashEntry `json:"entries"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// trashEntry permet de retrouver l'emplacement d'origine d'un fichier supprimé.
+type trashEntry struct {
+	Name         string    `json:"name"`
+	OriginalPath string    `json:"originalPath"`
+	DeletedAt    time.Time `json:"deletedAt"`
+	Size         int64     `json:"size,omitempty"`
+}
+
+// libraryActionHandler sert POST /library/rename, /library/move,
+// /library/delete et /library/tags.
+func libraryActionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req libraryActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	item, ok := library.lookup(r.Context(), req.ID)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(libraryActionResponse{OK: false, Error: "fichier introuvable dans la bibliothèque"})
+		return
+	}
+
+	var newPath string
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, "/library/") {
+	case "rename":
+		newPath, err = renameLibraryItem(item, req.Name)
+	case "move":
+		newPath, err = moveLibraryItem(item, req.Folder)
+	case "delete":
+		err = trashLibraryItem(item)
+	case "tags":
+		newPath, err = retagLibraryItem(r, item, req.Tags)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(libraryActionResponse{OK: false, Error: "action inconnue"})
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errFileExists) {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(libraryActionResponse{OK: false, Error: err.Error()})
+		return
+	}
+
+	resp := libraryActionResponse{OK: true}
+	library.scan(r.Context())
+	if newPath != "" {
+		if updated, ok := library.lookup(r.Context(), libraryID(newPath)); ok {
+			resp.Item = &updated
+		}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// renameLibraryItem renomme le fichier sur place; l'extension d'origine est conservée.
+func renameLibraryItem(item libraryItem, name string) (string, error) {
+	ext := filepath.Ext(item.Path)
+	base := sanitizeFileName(strings.TrimSuffix(strings.TrimSpace(name), ext))
+	if base == "" || base == "." || base == ".." {
+		return "", fmt.Errorf("nom de fichier invalide")
+	}
+	target := filepath.Join(filepath.Dir(item.Path), base+ext)
+	if target == item.Path {
+		return target, nil
+	}
+	if err := relocateFile(item.Path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// moveLibraryItem déplace le fichier à la racine d'un autre dossier configuré.
+func moveLibraryItem(item libraryItem, folder string) (string, error) {
+	var dest *libraryFolder
+	for i, f := range library.folders {
+		if f.Name == folder {
+			dest = &library.folders[i]
+			break
+		}
+	}
+	if dest == nil {
+		return "", fmt.Errorf("dossier %q inconnu", folder)
+	}
+	if err := os.MkdirAll(dest.Path, 0o755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dest.Path, filepath.Base(item.Path))
+	if target == item.Path {
+		return target, nil
+	}
+	if err := relocateFile(item.Path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// trashLibraryItem déplace le fichier dans la corbeille du dossier de
+// téléchargement et note son emplacement d'origine pour pouvoir le restaurer.
+func trashLibraryItem(item libraryItem) error {
+	dir := filepath.Join(baseDir, trashDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := now.Format("20060102-150405") + " " + filepath.Base(item.Path)
+	if err := moveFile(item.Path, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	archive.forgetFile(item.Path)
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries := readTrash()
+	entries = append(entries, trashEntry{Name: name, OriginalPath: item.Path, DeletedAt: now})
+	if err := writeTrash(entries); err != nil {
+		log.Printf("Manifeste de la corbeille non enregistré: %v\n", err)
+	}
+	return nil
+}
+
+// restoreTrashItem remet un fichier de la corbeille à son emplacement
+// d'origine, sans écraser un fichier apparu entre-temps.
+func restoreTrashItem(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == trashManifestName {
+		return "", fmt.Errorf("élément de corbeille invalide")
+	}
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries := readTrash()
+	for i, e := range entries {
+		if e.Name != name {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(e.OriginalPath), 0o755); err != nil {
+			return "", err
+		}
+		if err := relocateFile(filepath.Join(baseDir, trashDirName, name), e.OriginalPath); err != nil {
+			return "", err
+		}
+		entries = append(entries[:i], entries[i+1:]...)
+		if err := writeTrash(entries); err != nil {
+			log.Printf("Manifeste de la corbeille non enregistré: %v\n", err)
+		}
+		return e.OriginalPath, nil
+	}
+	return "", fmt.Errorf("%q absent de la corbeille", name)
+}
+
+// readTrash lit le manifeste de la corbeille; l'appelant tient trashMu.
+func readTrash() []trashEntry {
+	var entries []trashEntry
+	if data, err := os.ReadFile(filepath.Join(baseDir, trashDirName, trashManifestName)); err == nil {
+		_ = json.Unmarshal(data, &entries)
+	}
+	return entries
+}
+
+func writeTrash(entries []trashEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(baseDir, trashDirName, trashManifestName), data)
+}
+
+// trashHandler sert GET /library/trash, les fichiers encore présents dans la
+// corbeille du plus récent au plus ancien.
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	trashMu.Lock()
+	entries := readTrash()
+	trashMu.Unlock()
+	present := make([]trashEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if fi, err := os.Stat(filepath.Join(baseDir, trashDirName, e.Name)); err == nil {
+			e.Size = fi.Size()
+			present = append(present, e)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(trashResponse{OK: true, Entries: present})
+}
+
+// restoreHandler sert POST /library/restore; name désigne l'élément de la corbeille.
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req libraryActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	restored, err := restoreTrashItem(req.Name)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errFileExists) {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(libraryActionResponse{OK: false, Error: err.Error()})
+		return
+	}
+	resp := libraryActionResponse{OK: true}
+	library.scan(r.Context())
+	if item, ok := library.lookup(r.Context(), libraryID(restored)); ok {
+		resp.Item = &item
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func retagLibraryItem(r *http.Request, item libraryItem, edit *libraryTagEdit) (string, error) {
+	if item.Kind != "audio" {
+		return "", fmt.Errorf("seuls les fichiers audio peuvent être étiquetés")
+	}
+	if edit == nil {
+		return "", fmt.Errorf("aucune étiquette à modifier")
+	}
+	tags := make(map[string]string)
+	for key, value := range map[string]*string{"title": edit.Title, "artist": edit.Artist, "album": edit.Album} {
+		if value != nil {
+			tags[key] = strings.TrimSpace(*value)
+		}
+	}
+	if len(tags) == 0 {
+		return "", fmt.Errorf("aucune étiquette à modifier")
+	}
+	if err := writeTags(r.Context(), item.Path, tags); err != nil {
+		return "", err
+	}
+	return item.Path, nil
+}
+
+// relocateFile renomme ou déplace un fichier sans écraser la destination,
+// puis reporte le changement dans l'archive des téléchargements. Un simple
+// changement de casse reste possible sur les systèmes qui l'ignorent.
+func relocateFile(from, to string) error {
+	if target, err := os.Stat(to); err == nil {
+		source, serr := os.Stat(from)
+		if !strings.EqualFold(from, to) || serr != nil || !os.SameFile(source, target) {
+			return fmt.Errorf("%s: %w", filepath.Base(to), errFileExists)
+		}
+	}
+	if err := moveFile(from, to); err != nil {
+		return err
+	}
+	archive.renameFile(from, to)
+	return nil
+}
+
+// moveFile tente un simple renommage, puis une copie suivie d'une
+// suppression quand la destination est sur un autre volume.
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		_ = os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(to)
+		return err
+	}
+	src.Close()
+	return os.Remove(from)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	loudnessTruePeak = "-1.5"
+	loudnessRange    = "11"
+)
+
+var sampleRateRe = regexp.MustCompile(`Audio: [^\n]*?, (\d+) Hz`)
+
+// loudnessReport donne la sonie intégrée (LUFS) mesurée avant et après normalisation.
+type loudnessReport struct {
+	Target float64 `json:"target"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	OutputI      string `json:"output_i"`
+	TargetOffset string `json:"target_offset"`
+}
+
+func validateLoudnessTarget(target float64) error {
+	if target != 0 && (target < -70 || target > -5) {
+		return fmt.Errorf("cible de sonie %.1f LUFS hors limites (-70 à -5)", target)
+	}
+	return nil
+}
+
+// normalizeLoudness applique la normalisation EBU R128 en deux passes:
+// mesure, puis correction linéaire à partir des valeurs mesurées.
+func normalizeLoudness(ctx context.Context, path string, target float64, p preset) (*loudnessReport, error) {
+	filter := fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s", strconv.FormatFloat(target, 'f', 1, 64), loudnessTruePeak, loudnessRange)
+	out, err := runFFmpeg(ctx, "-i", path, "-vn", "-af", filter+":print_format=json", "-f", "null", "-")
+	if err != nil {
+		return nil, err
+	}
+	measured, err := parseLoudnorm(out)
+	if err != nil {
+		return nil, err
+	}
+	report := &loudnessReport{Target: target}
+	report.Before, _ = strconv.ParseFloat(measured.InputI, 64)
+
+	second := fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=json",
+		filter, measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+	sampleRate := "48000"
+	if m := sampleRateRe.FindStringSubmatch(out); m != nil {
+		sampleRate = m[1]
+	}
+	out, err = rewriteInPlace(ctx, path, func(tmp string) []string {
+		args := []string{"-i", path, "-map", "0", "-c", "copy", "-af", second, "-ar", sampleRate}
+		return append(append(args, audioEncoderArgs(path, p)...), tmp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result, err := parseLoudnorm(out); err == nil {
+		report.After, _ = strconv.ParseFloat(result.OutputI, 64)
+	}
+	return report, nil
+}
+
+// parseLoudnorm extrait le bloc JSON que loudnorm affiche en fin de traitement.
+func parseLoudnorm(output string) (*loudnormStats, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("mesure de sonie introuvable dans la sortie de ffmpeg")
+	}
+	var stats loudnormStats
+	if err := json.Unmarshal([]byte(output[start:end+1]), &stats); err != nil {
+		return nil, fmt.Errorf("mesure de sonie illisible: %w", err)
+	}
+	return &stats, nil
+}
+
+// audioEncoderArgs choisit l'encodeur audio adapté au conteneur, la piste
+// devant être réencodée pour appliquer le filtre.
+func audioEncoderArgs(path string, p preset) []string {
+	bitrate := "192k"
+	if q := strings.TrimSuffix(p.AudioQuality, "K"); q != "" && q != "0" {
+		bitrate = q + "k"
+	}
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case "mp3":
+		if p.AudioQuality == "" || p.AudioQuality == "0" {
+			return []string{"-c:a", "libmp3lame", "-q:a", "0"}
+		}
+		return []string{"-c:a", "libmp3lame", "-b:a", bitrate}
+	case "opus", "webm":
+		return []string{"-c:a", "libopus", "-b:a", bitrate}
+	case "ogg":
+		return []string{"-c:a", "libvorbis", "-b:a", bitrate}
+	case "flac":
+		return []string{"-c:a", "flac"}
+	case "wav":
+		return []string{"-c:a", "pcm_s16le"}
+	default:
+		return []string{"-c:a", "aac", "-b:a", bitrate}
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -25,8 +25,13 @@ var baseDir string
 var ytdlPath string
 
 var (
-	jobs                sync.Map
+	jobs               sync.Map
 	downloadProgressRe = regexp.MustCompile(`\[download\]\s+(\d+(?:\.\d+)?)%`)
+	destinationRe      = regexp.MustCompile(`^\[(?:download|ffmpeg|ExtractAudio)\] Destination: (.+)$`)
+	mergerRe           = regexp.MustCompile(`^\[Merger\] Merging formats into "(.+)"$`)
+	alreadyDoneRe      = regexp.MustCompile(`^\[download\] (.+) has already been downloaded`)
+	infoJSONRe         = regexp.MustCompile(`^\[info\] Writing video (?:description )?metadata as JSON to: (.+)$`)
+	subtitleRe         = regexp.MustCompile(`^\[info\] Writing video subtitles to: (.+)$`)
 )
 
 func main() {
@@ -51,10 +56,37 @@ func main() {
 		}
 	}
 
+	cfg = loadConfig(baseDir)
+	presets = loadPresets(cfg.Presets)
+	infoCache = newMetadataCache(cfg.Cache, baseDir)
+	hooks = loadHooks(cfg.Hooks)
+	policy = loadURLPolicy(cfg.URLPolicy)
+	archive = newDownloadArchive(baseDir)
+	library = newMediaLibrary(cfg.Library, baseDir)
+	storage = loadStorage(cfg.Storage)
+	cleanupSettings = loadCleanup(cfg.Cleanup)
+	go sweepOrphans()
+	ffmpegPath = locateTool("ffmpeg")
+	ffprobePath = locateTool("ffprobe")
+	go library.scan(context.Background())
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", indexHandler)
 	mux.HandleFunc("/download", downloadHandler)
 	mux.HandleFunc("/status", statusHandler)
+	mux.HandleFunc("/cancel", cancelHandler)
+	mux.HandleFunc("/presets", presetsHandler)
+	mux.HandleFunc("/formats", formatsHandler)
+	mux.HandleFunc("/info", infoHandler)
+	mux.HandleFunc("/batches/", batchesHandler)
+	mux.HandleFunc("/library", libraryHandler)
+	mux.HandleFunc("/storage", storageHandler)
+	mux.HandleFunc("/library/file/", libraryFileHandler)
+	for _, action := range []string{"rename", "move", "delete", "tags"} {
+		mux.HandleFunc("/library/"+action, libraryActionHandler)
+	}
+	mux.HandleFunc("/library/trash", trashHandler)
+	mux.HandleFunc("/library/restore", restoreHandler)
 
 	srv := &http.Server{
 		Addr:    "127.0.0.1:8080",
@@ -78,20 +110,61 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type downloadRequest struct {
-	URL  string `json:"url"`
-	Mode string `json:"mode"`
+	URL          string   `json:"url"`
+	URLs         []string `json:"urls"`
+	Mode         string   `json:"mode"`
+	Preset       string   `json:"preset"`
+	AudioFormat  string   `json:"audioFormat"`
+	AudioQuality string   `json:"audioQuality"`
+	MaxHeight    int      `json:"maxHeight"`
+	VideoCodec   string   `json:"videoCodec"`
+	MaxFPS       int      `json:"maxFps"`
+	HDR          string   `json:"hdr"`
+	FormatID     string   `json:"formatId"`
+
+	EmbedMetadata  bool        `json:"embedMetadata"`
+	EmbedThumbnail bool        `json:"embedThumbnail"`
+	SplitArtist    bool        `json:"splitArtist"`
+	Tags           *tagOptions `json:"tags"`
+
+	Subtitles     *subtitleOptions `json:"subtitles"`
+	SplitChapters bool             `json:"splitChapters"`
+
+	SponsorBlock *sponsorBlockOptions `json:"sponsorBlock"`
+	Start        string               `json:"start"`
+	End          string               `json:"end"`
+
+	LoudnessTarget float64 `json:"loudnessTarget"`
+
+	Scope           string `json:"scope"`
+	PlaylistItems   string `json:"playlistItems"`
+	ContinueOnError *bool  `json:"continueOnError"`
+
+	DateAfter     string `json:"dateAfter"`
+	DateBefore    string `json:"dateBefore"`
+	MaxItems      int    `json:"maxItems"`
+	MinDuration   string `json:"minDuration"`
+	MaxDuration   string `json:"maxDuration"`
+	IncludeShorts bool   `json:"includeShorts"`
+	Force         bool   `json:"force"`
+	Collision     string `json:"collision"`
 }
 
 type downloadResponse struct {
-	OK    bool   `json:"ok"`
-	ID    string `json:"id,omitempty"`
-	Error string `json:"error,omitempty"`
+	OK      bool        `json:"ok"`
+	ID      string      `json:"id,omitempty"`
+	BatchID string      `json:"batchId,omitempty"`
+	Items   []batchItem `json:"items,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	// Duplicate vaut "running" ou "archived" quand la demande rejoint un travail existant.
+	Duplicate string `json:"duplicate,omitempty"`
 }
 
 type statusResponse struct {
-	OK  bool       `json:"ok"`
-	Job *jobStatus `json:"job,omitempty"`
-	Error string   `json:"error,omitempty"`
+	OK    bool       `json:"ok"`
+	Job   *jobStatus `json:"job,omitempty"`
+	Error string     `json:"error,omitempty"`
 }
 
 func downloadHandler(w http.ResponseWriter, r *http.Request) {
@@ -106,23 +179,210 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "JSON invalide", http.StatusBadRequest)
 		return
 	}
-	if req.URL == "" {
+	urls := batchURLs(&req)
+	if req.URL == "" && len(urls) == 0 {
 		http.Error(w, "URL manquante", http.StatusBadRequest)
 		return
 	}
 
-	mode := normalizeMode(req.Mode)
-	cleanURL := normalizeVideoURL(req.URL)
-	job := newJob(mode)
+	p, opts, err := resolveJobSettings(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(urls) > 0 {
+		startBatch(w, r, &req, urls, p, opts)
+		return
+	}
+
+	job, run, err := createJob(r.Context(), &req, req.URL, p, opts)
+	if code := policyCode(err); code != "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(downloadResponse{OK: false, Error: err.Error(), Code: code})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := downloadResponse{OK: true, ID: job.snapshot().ID}
+	if run == nil {
+		resp.Duplicate = duplicateKind(job)
+	} else {
+		// Utilise un contexte de fond pour éviter l'annulation immédiate une fois la requête HTTP servie.
+		go run()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// createJob enregistre le travail correspondant à une URL selon la portée
+// demandée; run le déroule jusqu'au bout et doit être lancé par l'appelant.
+// run est nil quand la demande rejoint un travail existant (doublon).
+func createJob(ctx context.Context, req *downloadRequest, rawURL string, p preset, opts jobOptions) (*job, func(), error) {
+	if _, err := policy.check(rawURL); err != nil {
+		return nil, nil, err
+	}
+	switch strings.ToLower(strings.TrimSpace(req.Scope)) {
+	case "", "video":
+		return createVideoJob(ctx, req, rawURL, p, opts)
+	case "playlist":
+		return createPlaylistJob(req, rawURL, p, opts)
+	case "channel":
+		return createChannelJob(req, rawURL, p, opts)
+	default:
+		return nil, nil, fmt.Errorf("portée %q inconnue", req.Scope)
+	}
+}
+
+func createVideoJob(ctx context.Context, req *downloadRequest, rawURL string, p preset, opts jobOptions) (*job, func(), error) {
+	parsed, err := parseVideoURL(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch parsed.Kind {
+	case urlKindPlaylist:
+		return nil, nil, fmt.Errorf("cette URL désigne une playlist: choisissez la portée playlist")
+	case urlKindChannel:
+		return nil, nil, fmt.Errorf("cette URL désigne une chaîne: choisissez la portée chaîne")
+	}
+	cleanURL := parsed.Normalized
+	if opts.Range, err = resolveTimeRange(ctx, parsed, req.Start, req.End); err != nil {
+		return nil, nil, err
+	}
+	if opts.Range != nil && opts.SplitChapters {
+		return nil, nil, fmt.Errorf("un extrait ne peut pas être découpé par chapitres")
+	}
+	job := newJob(p, opts)
+	videoID := parsed.VideoID
+	if videoID == "" {
+		videoID = cleanURL
+	}
+	if dup := claimDownload(job, videoID, cleanURL); dup != nil {
+		if dup == job {
+			jobs.Store(job.snapshot().ID, job)
+		}
+		return dup, nil, nil
+	}
 	jobs.Store(job.snapshot().ID, job)
 
 	job.appendLog(fmt.Sprintf("URL normalisée: %s", cleanURL))
+	if info := cachedVideoInfo(cleanURL); info != nil {
+		job.update(func(s *jobStatus) { s.Title = info.Title })
+		job.appendLog(fmt.Sprintf("Titre: %s", info.Title))
+	}
+	return job, func() { startDownload(context.Background(), job, cleanURL) }, nil
+}
 
-	// Utilise un contexte de fond pour éviter l'annulation immédiate une fois la requête HTTP servie.
-	go startDownload(context.Background(), job, cleanURL)
+func createPlaylistJob(req *downloadRequest, rawURL string, p preset, opts jobOptions) (*job, func(), error) {
+	if strings.TrimSpace(req.Start) != "" || strings.TrimSpace(req.End) != "" {
+		return nil, nil, fmt.Errorf("un extrait ne s'applique pas à une playlist")
+	}
+	if _, err := parseItemRanges(req.PlaylistItems); err != nil {
+		return nil, nil, err
+	}
+	listURL, err := playlistURL(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	copts := collectionOptions{Items: req.PlaylistItems, ContinueOnError: true}
+	if req.ContinueOnError != nil {
+		copts.ContinueOnError = *req.ContinueOnError
+	}
+	job := newJob(p, opts)
+	job.update(func(s *jobStatus) { s.Kind = "playlist" })
+	jobs.Store(job.snapshot().ID, job)
+	job.appendLog(fmt.Sprintf("Playlist: %s", listURL))
+	return job, cancellable(job, func(ctx context.Context) { startPlaylist(ctx, job, listURL, copts) }), nil
+}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(downloadResponse{OK: true, ID: job.snapshot().ID})
+func createChannelJob(req *downloadRequest, rawURL string, p preset, opts jobOptions) (*job, func(), error) {
+	if strings.TrimSpace(req.Start) != "" || strings.TrimSpace(req.End) != "" {
+		return nil, nil, fmt.Errorf("un extrait ne s'applique pas à une chaîne")
+	}
+	base, err := channelURL(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	filters := channelFilters{MaxItems: req.MaxItems, IncludeShorts: req.IncludeShorts}
+	if filters.DateAfter, err = parseFilterDate(req.DateAfter); err == nil {
+		filters.DateBefore, err = parseFilterDate(req.DateBefore)
+	}
+	if err == nil {
+		filters.MinDuration, err = parseTimestamp(req.MinDuration)
+	}
+	if err == nil {
+		filters.MaxDuration, err = parseTimestamp(req.MaxDuration)
+	}
+	if err == nil {
+		err = filters.validate()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	continueOnError := true
+	if req.ContinueOnError != nil {
+		continueOnError = *req.ContinueOnError
+	}
+	job := newJob(p, opts)
+	job.update(func(s *jobStatus) { s.Kind = "channel" })
+	jobs.Store(job.snapshot().ID, job)
+	job.appendLog(fmt.Sprintf("Chaîne: %s", base))
+	return job, cancellable(job, func(ctx context.Context) { startChannel(ctx, job, base, filters, continueOnError) }), nil
+}
+
+// resolveJobSettings applique au préréglage choisi les options du formulaire
+// et valide celles qui ne dépendent pas de l'URL.
+func resolveJobSettings(req *downloadRequest) (preset, jobOptions, error) {
+	p, err := resolvePreset(req.Preset, req.Mode)
+	if err != nil {
+		return p, jobOptions{}, err
+	}
+	if err := applyAudioOptions(&p, req.AudioFormat, req.AudioQuality); err != nil {
+		return p, jobOptions{}, err
+	}
+	if err := applyVideoOptions(&p, req.MaxHeight, req.VideoCodec, req.MaxFPS, req.HDR); err != nil {
+		return p, jobOptions{}, err
+	}
+	if err := applyFormatID(&p, req.FormatID); err != nil {
+		return p, jobOptions{}, err
+	}
+	opts := jobOptions{
+		EmbedMetadata:  req.EmbedMetadata,
+		EmbedThumbnail: req.EmbedThumbnail,
+		SplitArtist:    req.SplitArtist,
+		Subtitles:      req.Subtitles,
+		SplitChapters:  req.SplitChapters,
+		Force:          req.Force,
+	}
+	if opts.Collision, err = validateCollision(req.Collision); err != nil {
+		return p, opts, err
+	}
+	if req.Tags != nil {
+		opts.Tags = *req.Tags
+	}
+	if err := validateMetadataOptions(p, opts); err != nil {
+		return p, opts, err
+	}
+	if err := validateSubtitleOptions(p, opts.Subtitles); err != nil {
+		return p, opts, err
+	}
+	if opts.SplitChapters && p.Mode != "audio" {
+		return p, opts, fmt.Errorf("le découpage par chapitres ne concerne que l'audio seul")
+	}
+	if err := validateLoudnessTarget(req.LoudnessTarget); err != nil {
+		return p, opts, err
+	}
+	if req.LoudnessTarget != 0 {
+		p.LoudnessTarget = req.LoudnessTarget
+	}
+	if opts.SponsorBlock, err = resolveSponsorBlock(p, req.SponsorBlock); err != nil {
+		return p, opts, err
+	}
+	return p, opts, nil
 }
 
 func statusHandler(w http.ResponseWriter, r *http.Request) {
@@ -147,19 +407,80 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(statusResponse{OK: true, Job: &status})
 }
 
+// cancelHandler sert POST /cancel?id=...: le téléchargeur est interrompu et
+// les fichiers provisoires du travail supprimés.
+func cancelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	value, ok := jobs.Load(r.URL.Query().Get("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(statusResponse{OK: false, Error: "téléchargement introuvable"})
+		return
+	}
+	job := value.(*job)
+	if !job.requestCancel() {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(statusResponse{OK: false, Error: "téléchargement déjà terminé"})
+		return
+	}
+	job.appendLog("Annulation demandée")
+	status := job.snapshot()
+	_ = json.NewEncoder(w).Encode(statusResponse{OK: true, Job: &status})
+}
+
 func openBrowser(url string) {
 	cmd := exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
 	_ = cmd.Start()
 }
 
 type job struct {
-	mu     sync.RWMutex
-	state  jobStatus
+	mu        sync.RWMutex
+	state     jobStatus
+	preset    preset
+	opts      jobOptions
+	output    string
+	infoPath  string
+	subtitles []string
+	key       string
+	videoID   string
+	sourceURL string
+	artifacts []string
+	cancel    context.CancelFunc
+	cancelled bool
+	// space est la place disque réservée au téléchargement en cours.
+	space *spaceReservation
+	// abortErr explique un arrêt décidé par l'application, pas par l'utilisateur.
+	abortErr error
+}
+
+// jobOptions regroupe les options propres à un travail, en plus de son préréglage.
+type jobOptions struct {
+	EmbedMetadata  bool
+	EmbedThumbnail bool
+	SplitArtist    bool
+	Tags           tagOptions
+	Subtitles      *subtitleOptions
+	SplitChapters  bool
+	SponsorBlock   *sponsorBlockOptions
+	Range          *timeRange
+	Force          bool
+	Collision      string
 }
 
 type jobStatus struct {
 	ID            string     `json:"id"`
+	Kind          string     `json:"kind"`
+	ParentID      string     `json:"parentId,omitempty"`
+	BatchID       string     `json:"batchId,omitempty"`
+	Children      []string   `json:"children,omitempty"`
+	Counts        *jobCounts `json:"counts,omitempty"`
 	Mode          string     `json:"mode"`
+	Preset        string     `json:"preset"`
+	Title         string     `json:"title,omitempty"`
 	Status        string     `json:"status"`
 	DownloadPct   float64    `json:"downloadPct"`
 	ConversionPct float64    `json:"conversionPct"`
@@ -167,15 +488,37 @@ type jobStatus struct {
 	Log           string     `json:"log"`
 	Error         string     `json:"error,omitempty"`
 	Finished      bool       `json:"finished"`
+	Archived      bool       `json:"archived,omitempty"`
 	StartedAt     time.Time  `json:"startedAt"`
 	CompletedAt   *time.Time `json:"completedAt,omitempty"`
+	Result        *jobResult `json:"result,omitempty"`
+}
+
+type jobResult struct {
+	Files     []string     `json:"files"`
+	Ext       string       `json:"ext"`
+	Subtitles []string     `json:"subtitles,omitempty"`
+	Quality   *qualityInfo `json:"quality,omitempty"`
+
+	SponsorBlock *sponsorBlockReport `json:"sponsorBlock,omitempty"`
+	Range        *timeRange          `json:"range,omitempty"`
+	Loudness     []loudnessReport    `json:"loudness,omitempty"`
+	Duration     float64             `json:"duration,omitempty"`
+	// Skipped indique qu'un fichier de même nom existait et a été conservé.
+	Skipped bool `json:"skipped,omitempty"`
+	// finalBase est le nom définitif calculé par le téléchargeur.
+	finalBase string
 }
 
-func newJob(mode string) *job {
+func newJob(p preset, opts jobOptions) *job {
 	return &job{
+		preset: p,
+		opts:   opts,
 		state: jobStatus{
 			ID:            newJobID(),
-			Mode:          mode,
+			Kind:          "video",
+			Mode:          p.Mode,
+			Preset:        p.Name,
 			Status:        "préparation",
 			DownloadPct:   0,
 			ConversionPct: -1,
@@ -196,6 +539,130 @@ func (j *job) update(fn func(*jobStatus)) {
 	fn(&j.state)
 }
 
+func (j *job) setOutput(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.output = path
+}
+
+func (j *job) outputPath() string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.output
+}
+
+func (j *job) addSubtitle(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.subtitles = append(j.subtitles, path)
+}
+
+func (j *job) subtitleFiles() []string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]string(nil), j.subtitles...)
+}
+
+func (j *job) setInfoPath(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.infoPath = path
+}
+
+func (j *job) discardInfo() {
+	j.mu.RLock()
+	path := j.infoPath
+	j.mu.RUnlock()
+	if path != "" {
+		_ = os.Remove(path)
+	}
+}
+
+// takeInfo lit puis supprime le fichier d'informations écrit par le téléchargeur.
+func (j *job) takeInfo() *videoInfo {
+	j.mu.RLock()
+	path := j.infoPath
+	j.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	defer os.Remove(path)
+	info, err := readInfoJSON(path)
+	if err != nil {
+		j.appendLog(fmt.Sprintf("Informations indisponibles: %v", err))
+		return nil
+	}
+	return info
+}
+
+var errJobCancelled = errors.New("annulé par l'utilisateur")
+
+// setCancel enregistre la fonction qui interrompt le travail; elle renvoie
+// false, sans rien enregistrer, si le travail a déjà été annulé.
+func (j *job) setCancel(cancel context.CancelFunc) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancelled {
+		return false
+	}
+	j.cancel = cancel
+	return true
+}
+
+// requestCancel marque le travail et ses enfants comme annulés et interrompt
+// ce qui tourne; un travail encore en file s'arrêtera dès son lancement.
+func (j *job) requestCancel() bool {
+	j.mu.Lock()
+	if j.state.Finished {
+		j.mu.Unlock()
+		return false
+	}
+	j.cancelled = true
+	if j.cancel != nil {
+		j.cancel()
+	}
+	children := j.state.Children
+	j.mu.Unlock()
+	for _, id := range children {
+		if value, ok := jobs.Load(id); ok {
+			value.(*job).requestCancel()
+		}
+	}
+	return true
+}
+
+// abort interrompt le travail en cours pour la raison donnée.
+func (j *job) abort(err error) {
+	j.mu.Lock()
+	if j.abortErr == nil {
+		j.abortErr = err
+	}
+	cancel := j.cancel
+	j.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (j *job) isCancelled() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.cancelled
+}
+
+// cancellable donne au travail parent un contexte que /cancel peut interrompre.
+func cancellable(job *job, run func(ctx context.Context)) func() {
+	return func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if !job.setCancel(cancel) {
+			jobFailed(job, errJobCancelled)
+			return
+		}
+		run(ctx)
+	}
+}
+
 func (j *job) appendLog(line string) {
 	j.update(func(s *jobStatus) {
 		if s.Log != "" {
@@ -209,22 +676,43 @@ func (j *job) appendLog(line string) {
 func startDownload(parentCtx context.Context, job *job, url string) {
 	ctx, cancel := context.WithTimeout(parentCtx, 60*time.Minute)
 	defer cancel()
+	defer releaseDownload(job)
+	if !job.setCancel(cancel) {
+		jobFailed(job, errJobCancelled)
+		return
+	}
 
-	args := []string{"--newline", "-o", "%(title)s.%(ext)s"}
-	switch job.snapshot().Mode {
-	case "audio":
-		args = append(args,
-			"-f", "bestaudio/best",
-			"--extract-audio",
-			"--audio-format", "mp3",
-			"--audio-quality", "0",
-		)
-	default:
-		args = append(args,
-			"-f", "bestvideo[ext=mp4][vcodec!*=av01]+bestaudio[ext=m4a]/best[ext=mp4][vcodec!*=av01]/best[ext=mp4]/best",
-			"--merge-output-format", "mp4",
-		)
+	space, err := reserveSpace(ctx, job, url)
+	if err != nil {
+		jobFailed(job, err)
+		return
+	}
+	defer space.release()
+	job.mu.Lock()
+	job.space = space
+	job.mu.Unlock()
+
+	if existing := existingOutput(job, url); existing != "" {
+		job.appendLog(fmt.Sprintf("%s existe déjà, téléchargement évité", filepath.Base(existing)))
+		completion := time.Now()
+		job.update(func(s *jobStatus) {
+			s.Status = "terminé"
+			s.Result = &jobResult{Files: []string{existing}, Ext: strings.TrimPrefix(filepath.Ext(existing), "."), Skipped: true}
+			s.DownloadPct = 100
+			s.ConversionPct = 100
+			s.Finished = true
+			s.CompletedAt = &completion
+		})
+		return
+	}
+
+	args := append(stagingTemplate(presetArgs(job.preset), job.stagingID()), embedArgs(job.opts)...)
+	args = append(args, subtitleArgs(job.opts.Subtitles)...)
+	args = append(args, sponsorBlockArgs(job)...)
+	if job.preset.HDR != "" && !dynamicRangeSupported() {
+		job.appendLog("Préférence HDR ignorée: le téléchargeur installé ne la prend pas en charge")
 	}
+	args = append(args, sectionArgs(job.opts.Range)...)
 	args = append(args, url)
 
 	cmd := exec.CommandContext(ctx, ytdlPath, args...)
@@ -245,16 +733,57 @@ func startDownload(parentCtx context.Context, job *job, url string) {
 		return
 	}
 
-	reader := bufio.NewReader(io.MultiReader(stdout, stderr))
-	go streamLines(job, reader)
+	// Toute la sortie doit être lue avant Wait, qui ferme les tubes.
+	var readers sync.WaitGroup
+	for _, pipe := range []io.Reader{stdout, stderr} {
+		readers.Add(1)
+		go func(pipe io.Reader) {
+			defer readers.Done()
+			streamLines(job, bufio.NewReader(pipe), "")
+		}(pipe)
+	}
+	readers.Wait()
 
 	if err := cmd.Wait(); err != nil {
+		job.discardInfo()
+		jobFailed(job, err)
+		return
+	}
+	result := &jobResult{Ext: expectedExtension(job.preset)}
+	if out := job.outputPath(); out != "" {
+		result.Files = []string{out}
+		result.Ext = strings.TrimPrefix(filepath.Ext(out), ".")
+	}
+	if opts := job.opts.Subtitles; opts != nil && !opts.Embed {
+		result.Subtitles = subtitleSidecars(job.subtitleFiles())
+	}
+	result.finalBase = resolveFinalName(ctx, job)
+	info := job.takeInfo()
+	if info != nil {
+		job.update(func(s *jobStatus) { s.Title = info.Title })
+		result.Duration = info.Duration
+		if r := job.opts.Range; r != nil {
+			end := r.End
+			if end == 0 {
+				end = info.Duration
+			}
+			result.Duration = end - r.Start
+		}
+		result.Quality = info.quality()
+		job.appendLog(fmt.Sprintf("Qualité obtenue: %s", result.Quality.Summary))
+		if opts := job.opts.SponsorBlock; opts != nil {
+			result.SponsorBlock = sponsorBlockSummary(opts, info.SponsorblockChapters)
+			job.appendLog(result.SponsorBlock.String())
+		}
+	}
+	if err := postProcess(ctx, job, info, result); err != nil {
 		jobFailed(job, err)
 		return
 	}
 	completion := time.Now()
 	job.update(func(s *jobStatus) {
 		s.Status = "terminé"
+		s.Result = result
 		s.DownloadPct = 100
 		if s.ConversionPct < 0 {
 			s.ConversionPct = 100
@@ -266,19 +795,24 @@ func startDownload(parentCtx context.Context, job *job, url string) {
 	})
 }
 
-func streamLines(job *job, reader *bufio.Reader) {
+// streamLines recopie la sortie d'un processus dans le journal du travail.
+// Sans préfixe il s'agit du téléchargeur, dont les lignes sont interprétées;
+// les autres commandes (hooks) sont journalisées sous leur préfixe.
+func streamLines(job *job, reader *bufio.Reader, prefix string) {
 	for {
 		line, err := reader.ReadString('\n')
 		if len(line) > 0 {
 			clean := strings.TrimSpace(strings.ReplaceAll(line, "\r", ""))
 			if clean != "" {
-				job.appendLog(clean)
-				interpretLine(job, clean)
+				job.appendLog(prefix + clean)
+				if prefix == "" {
+					interpretLine(job, clean)
+				}
 			}
 		}
 		if err != nil {
 			if err != io.EOF {
-				job.appendLog(fmt.Sprintf("flux interrompu: %v", err))
+				job.appendLog(fmt.Sprintf("%sflux interrompu: %v", prefix, err))
 			}
 			return
 		}
@@ -287,6 +821,14 @@ func streamLines(job *job, reader *bufio.Reader) {
 
 func interpretLine(job *job, line string) {
 	if matches := downloadProgressRe.FindStringSubmatch(line); len(matches) == 2 {
+		// Au premier progrès, le fichier d'informations est écrit: la place
+		// réservée peut être ajustée aux formats réellement choisis.
+		job.mu.RLock()
+		space := job.space
+		job.mu.RUnlock()
+		if space != nil {
+			space.adjust(job)
+		}
 		if pct, err := strconv.ParseFloat(matches[1], 64); err == nil {
 			job.update(func(s *jobStatus) {
 				s.Status = "téléchargement"
@@ -295,6 +837,23 @@ func interpretLine(job *job, line string) {
 		}
 		return
 	}
+	if matches := infoJSONRe.FindStringSubmatch(line); len(matches) == 2 {
+		job.setInfoPath(resolveOutput(matches[1]))
+		job.trackArtifact(resolveOutput(matches[1]))
+		return
+	}
+	if matches := subtitleRe.FindStringSubmatch(line); len(matches) == 2 {
+		job.addSubtitle(resolveOutput(matches[1]))
+		job.trackArtifact(resolveOutput(matches[1]))
+		return
+	}
+	for _, re := range []*regexp.Regexp{destinationRe, mergerRe, alreadyDoneRe} {
+		if matches := re.FindStringSubmatch(line); len(matches) == 2 && !isSubtitleFile(matches[1]) {
+			job.setOutput(resolveOutput(matches[1]))
+			job.trackArtifact(resolveOutput(matches[1]))
+			break
+		}
+	}
 	if strings.Contains(line, "[ffmpeg]") || strings.Contains(line, "[Merger]") || strings.Contains(strings.ToLower(line), "conversion") {
 		job.update(func(s *jobStatus) {
 			s.Status = "conversion"
@@ -305,11 +864,30 @@ func interpretLine(job *job, line string) {
 	}
 }
 
+func resolveOutput(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(baseDir, name)
+}
+
+// jobFailed clôt le travail en erreur, ou comme annulé si l'utilisateur l'a
+// demandé, après avoir supprimé ses fichiers provisoires.
 func jobFailed(job *job, err error) {
+	cleanupArtifacts(job)
+	status := "erreur"
+	job.mu.RLock()
+	abortErr := job.abortErr
+	job.mu.RUnlock()
+	if abortErr != nil {
+		err = abortErr
+	} else if job.isCancelled() {
+		status, err = "annulé", errJobCancelled
+	}
 	completion := time.Now()
 	job.appendLog(fmt.Sprintf("Erreur: %v", err))
 	job.update(func(s *jobStatus) {
-		s.Status = "erreur"
+		s.Status = status
 		s.Error = err.Error()
 		s.Message = err.Error()
 		s.Finished = true
@@ -334,43 +912,6 @@ func newJobID() string {
 	return hex.EncodeToString(b)
 }
 
-func normalizeVideoURL(raw string) string {
-	trimmed := strings.TrimSpace(raw)
-	if trimmed == "" {
-		return raw
-	}
-	u, err := url.Parse(trimmed)
-	if err != nil {
-		return trimmed
-	}
-	host := strings.ToLower(u.Host)
-	path := strings.Trim(u.Path, "/")
-	makeWatch := func(id string) string {
-		id = strings.TrimSpace(id)
-		if id == "" {
-			return trimmed
-		}
-		return fmt.Sprintf("https://www.youtube.com/watch?v=%s", id)
-	}
-	if host == "youtu.be" || host == "www.youtu.be" {
-		parts := strings.Split(path, "/")
-		if len(parts) > 0 {
-			return makeWatch(parts[0])
-		}
-	}
-	if strings.Contains(host, "youtube.com") {
-		if id := u.Query().Get("v"); id != "" {
-			return makeWatch(id)
-		}
-		if strings.HasPrefix(path, "shorts/") {
-			id := strings.TrimPrefix(path, "shorts/")
-			id = strings.Split(id, "/")[0]
-			return makeWatch(id)
-		}
-	}
-	return trimmed
-}
-
 const indexHTML = `<!doctype html>
 <html lang="fr">
 <head>
@@ -425,7 +966,7 @@ const indexHTML = `<!doctype html>
       font-weight: 600;
       margin-bottom: 8px;
     }
-    input[type="text"] {
+    input[type="text"], input[type="date"], input[type="number"], textarea {
       width: 100%;
       padding: 16px;
       border-radius: 16px;
@@ -435,11 +976,42 @@ const indexHTML = `<!doctype html>
       font-size: 1rem;
       transition: border 0.3s, box-shadow 0.3s;
     }
-    input[type="text"]:focus {
+    textarea {
+      resize: vertical;
+      font-family: inherit;
+    }
+    input[type="text"]:focus, textarea:focus {
       outline: none;
       border-color: var(--primary);
       box-shadow: 0 0 0 3px rgba(255, 77, 90, 0.25);
     }
+    .preview {
+      display: flex;
+      gap: 16px;
+      align-items: center;
+      margin-top: 16px;
+      padding: 16px;
+      border: 1px solid var(--border);
+      border-radius: 18px;
+      background: rgba(255, 255, 255, 0.02);
+    }
+    .preview[hidden] { display: none; }
+    .preview img {
+      width: 160px;
+      aspect-ratio: 16 / 9;
+      object-fit: cover;
+      border-radius: 12px;
+      background: rgba(148, 163, 184, 0.2);
+    }
+    .preview h3 {
+      margin: 0 0 6px;
+      font-size: 1rem;
+    }
+    .preview p {
+      margin: 0;
+      color: var(--muted);
+      font-size: 0.9rem;
+    }
     .mode-selector {
       display: grid;
       grid-template-columns: repeat(auto-fit, minmax(220px, 1fr));
@@ -475,6 +1047,56 @@ const indexHTML = `<!doctype html>
       color: var(--muted);
       font-size: 0.9rem;
     }
+    .options {
+      display: grid;
+      grid-template-columns: repeat(auto-fit, minmax(200px, 1fr));
+      gap: 16px;
+      margin: 16px 0;
+    }
+    .options[hidden], .options > div[hidden] { display: none; }
+    select {
+      width: 100%;
+      padding: 12px 16px;
+      border-radius: 14px;
+      border: 1px solid var(--border);
+      background: rgba(15, 23, 42, 0.6);
+      color: var(--text);
+      font-size: 0.95rem;
+    }
+    select:disabled { opacity: 0.5; }
+    .toggles {
+      display: flex;
+      flex-wrap: wrap;
+      gap: 12px 24px;
+      margin-bottom: 16px;
+    }
+    .toggles label[hidden] { display: none; }
+    .toggles label {
+      display: flex;
+      align-items: center;
+      gap: 8px;
+      font-weight: 500;
+      margin: 0;
+      cursor: pointer;
+    }
+    .format-picker {
+      display: grid;
+      gap: 12px;
+      margin-bottom: 16px;
+    }
+    .format-picker select[hidden] { display: none; }
+    button.secondary {
+      justify-self: start;
+      padding: 10px 16px;
+      border-radius: 14px;
+      border: 1px solid var(--border);
+      background: rgba(255, 255, 255, 0.04);
+      color: var(--text);
+      font-weight: 600;
+      cursor: pointer;
+    }
+    button.secondary:disabled { opacity: 0.6; cursor: wait; }
+    button.secondary[hidden] { display: none; }
     button.primary {
       width: 100%;
       padding: 16px;
@@ -562,8 +1184,38 @@ const indexHTML = `<!doctype html>
       overflow: auto;
       white-space: pre-wrap;
     }
+    .library-tools {
+      display: grid;
+      grid-template-columns: 1fr auto auto auto;
+      gap: 12px;
+      margin-bottom: 16px;
+    }
+    .library-list {
+      list-style: none;
+      margin: 0;
+      padding: 0;
+      max-height: 420px;
+      overflow: auto;
+    }
+    .library-list li {
+      display: flex;
+      align-items: center;
+      justify-content: space-between;
+      gap: 12px;
+      padding: 12px 0;
+      border-bottom: 1px solid var(--border);
+    }
+    .library-list .meta { color: var(--muted); font-size: 0.85rem; }
+    .library-list li > div:last-child { display: flex; flex-wrap: wrap; gap: 6px; justify-content: flex-end; }
+    .library-player video, .library-player audio {
+      width: 100%;
+      margin-bottom: 16px;
+      border-radius: 16px;
+    }
+    .library-player[hidden] { display: none; }
     @media (max-width: 600px) {
       body { padding: 16px; }
+      .library-tools { grid-template-columns: 1fr; }
       .card { padding: 20px; }
     }
   </style>
@@ -576,21 +1228,220 @@ const indexHTML = `<!doctype html>
         <p class="description">Téléchargements de vidéos ou musiques YouTube sur PC ElectroDepot en un clic.</p>
       </header>
       <div class="form">
-        <label for="url">URL YouTube</label>
-        <input type="text" id="url" placeholder="https://www.youtube.com/watch?v=..." autocomplete="off" />
+        <label for="url">URL YouTube (une par ligne pour un lot)</label>
+        <textarea id="url" rows="2" placeholder="https://www.youtube.com/watch?v=..." autocomplete="off"></textarea>
+        <div class="preview" id="preview" hidden>
+          <img id="previewThumb" alt="" />
+          <div>
+            <h3 id="previewTitle"></h3>
+            <p id="previewChannel"></p>
+            <p id="previewMeta"></p>
+            <p id="previewSubs"></p>
+          </div>
+        </div>
+        <div class="options">
+          <div>
+            <label for="scope">Portée</label>
+            <select id="scope">
+              <option value="video">Vidéo seule</option>
+              <option value="playlist">Playlist complète</option>
+              <option value="channel">Chaîne entière</option>
+            </select>
+          </div>
+          <div class="playlist-only" hidden>
+            <label for="playlistItems">Éléments (facultatif)</label>
+            <input type="text" id="playlistItems" placeholder="1-5,8,12-" autocomplete="off" />
+          </div>
+          <div class="collection-only" hidden>
+            <label for="onError">En cas d'erreur</label>
+            <select id="onError">
+              <option value="continue">Continuer avec les suivants</option>
+              <option value="stop">Arrêter la playlist</option>
+            </select>
+          </div>
+        </div>
+        <div class="options channel-only" hidden>
+          <div>
+            <label for="dateAfter">Publiées depuis le</label>
+            <input type="date" id="dateAfter" />
+          </div>
+          <div>
+            <label for="dateBefore">Publiées jusqu'au</label>
+            <input type="date" id="dateBefore" />
+          </div>
+          <div>
+            <label for="maxItems">Nombre maximal</label>
+            <input type="number" id="maxItems" min="0" placeholder="illimité" />
+          </div>
+          <div>
+            <label for="minDuration">Durée min.</label>
+            <input type="text" id="minDuration" placeholder="0:30" autocomplete="off" />
+          </div>
+          <div>
+            <label for="maxDuration">Durée max.</label>
+            <input type="text" id="maxDuration" placeholder="1:00:00" autocomplete="off" />
+          </div>
+          <div class="toggles">
+            <label><input type="checkbox" id="includeShorts" /> Inclure les Shorts</label>
+          </div>
+        </div>
         <div class="mode-selector" id="modeSelector">
           <label class="mode-card active">
-            <input type="radio" name="mode" value="video" checked />
+            <input type="radio" name="mode" value="video" data-mode="video" checked />
             <h3>Vidéo + Audio</h3>
             <span>MP4 optimisé (jusqu'à 1080p) avec fusion automatique.</span>
           </label>
           <label class="mode-card">
-            <input type="radio" name="mode" value="audio" />
+            <input type="radio" name="mode" value="audio" data-mode="audio" />
             <h3>Audio seul</h3>
             <span>Extraction MP3 haute qualité idéale pour les podcasts & musique.</span>
           </label>
         </div>
+        <div class="options" id="videoOptions">
+          <div>
+            <label for="maxHeight">Résolution max.</label>
+            <select id="maxHeight">
+              <option value="">Selon le préréglage</option>
+              <option value="2160">2160p (4K)</option>
+              <option value="1440">1440p</option>
+              <option value="1080">1080p</option>
+              <option value="720">720p</option>
+              <option value="480">480p</option>
+            </select>
+          </div>
+          <div>
+            <label for="videoCodec">Codec préféré</label>
+            <select id="videoCodec">
+              <option value="">Automatique</option>
+              <option value="h264">H.264 (compatible)</option>
+              <option value="vp9">VP9</option>
+              <option value="av1">AV1</option>
+            </select>
+          </div>
+          <div>
+            <label for="maxFps">Images / seconde</label>
+            <select id="maxFps">
+              <option value="">Automatique</option>
+              <option value="60">Jusqu'à 60</option>
+              <option value="30">Jusqu'à 30</option>
+            </select>
+          </div>
+          <div>
+            <label for="hdr">Dynamique</label>
+            <select id="hdr">
+              <option value="">Indifférent</option>
+              <option value="sdr">SDR de préférence</option>
+              <option value="hdr">HDR de préférence</option>
+            </select>
+          </div>
+        </div>
+        <div class="options" id="audioOptions" hidden>
+          <div>
+            <label for="audioFormat">Format audio</label>
+            <select id="audioFormat">
+              <option value="">Selon le préréglage</option>
+              <option value="mp3">MP3</option>
+              <option value="m4a">M4A (AAC)</option>
+              <option value="aac">AAC brut</option>
+              <option value="opus">Opus</option>
+              <option value="flac">FLAC (sans perte)</option>
+              <option value="wav">WAV (sans perte)</option>
+            </select>
+          </div>
+          <div>
+            <label for="audioQuality">Qualité</label>
+            <select id="audioQuality">
+              <option value="">Selon le préréglage</option>
+              <option value="0">Meilleure (VBR)</option>
+              <option value="320">320 kbit/s</option>
+              <option value="256">256 kbit/s</option>
+              <option value="192">192 kbit/s</option>
+              <option value="128">128 kbit/s</option>
+            </select>
+          </div>
+        </div>
+        <div class="toggles">
+          <label><input type="checkbox" id="embedMetadata" checked /> Intégrer les métadonnées</label>
+          <label><input type="checkbox" id="embedThumbnail" checked /> Intégrer la miniature</label>
+          <label><input type="checkbox" id="splitArtist" /> Séparer « Artiste - Titre »</label>
+          <label id="splitChaptersToggle" hidden><input type="checkbox" id="splitChapters" /> Une piste par chapitre</label>
+          <label><input type="checkbox" id="force" /> Retélécharger même si déjà présent</label>
+        </div>
+        <div class="options" id="tagOptions">
+          <div>
+            <label for="tagArtist">Artiste (facultatif)</label>
+            <input type="text" id="tagArtist" autocomplete="off" />
+          </div>
+          <div>
+            <label for="tagAlbum">Album (facultatif)</label>
+            <input type="text" id="tagAlbum" autocomplete="off" />
+          </div>
+        </div>
+        <div class="options">
+          <div>
+            <label for="clipStart">Début de l'extrait</label>
+            <input type="text" id="clipStart" placeholder="0:00 (ou t= de l'URL)" autocomplete="off" />
+          </div>
+          <div>
+            <label for="clipEnd">Fin de l'extrait</label>
+            <input type="text" id="clipEnd" placeholder="fin de la vidéo" autocomplete="off" />
+          </div>
+          <div>
+            <label for="sponsorBlock">SponsorBlock</label>
+            <select id="sponsorBlock">
+              <option value="">Selon le préréglage</option>
+              <option value="remove">Couper sponsors, intros, outros et autopromo</option>
+              <option value="mark">Marquer ces segments en chapitres</option>
+            </select>
+          </div>
+          <div>
+            <label for="loudness">Normalisation du volume</label>
+            <select id="loudness">
+              <option value="">Selon le préréglage</option>
+              <option value="-14">-14 LUFS (musique, streaming)</option>
+              <option value="-16">-16 LUFS (podcasts)</option>
+              <option value="-23">-23 LUFS (EBU R128, diffusion)</option>
+            </select>
+          </div>
+          <div>
+            <label for="collision">Si le fichier existe déjà</label>
+            <select id="collision">
+              <option value="suffix">Ajouter un numéro</option>
+              <option value="id">Ajouter l'identifiant de la vidéo</option>
+              <option value="skip">Conserver l'existant</option>
+              <option value="overwrite">Remplacer</option>
+            </select>
+          </div>
+        </div>
+        <div class="options" id="subtitleOptions">
+          <div>
+            <label for="subLangs">Sous-titres (langues)</label>
+            <input type="text" id="subLangs" placeholder="fr, en" autocomplete="off" />
+          </div>
+          <div>
+            <label for="subKind">Source</label>
+            <select id="subKind">
+              <option value="manual">Manuels</option>
+              <option value="auto">Automatiques</option>
+              <option value="both">Manuels + automatiques</option>
+            </select>
+          </div>
+          <div>
+            <label for="subEmbed">Destination</label>
+            <select id="subEmbed">
+              <option value="sidecar">Fichier SRT séparé</option>
+              <option value="embed">Intégrés au MP4</option>
+            </select>
+          </div>
+        </div>
+        <div class="format-picker">
+          <button type="button" class="secondary" id="formatsBtn">Choisir un format précis…</button>
+          <select id="formatSelect" hidden>
+            <option value="">Choix automatique</option>
+          </select>
+        </div>
         <button class="primary" id="downloadBtn">Lancer le téléchargement</button>
+        <button type="button" class="secondary" id="cancelBtn" hidden>Annuler</button>
         <div class="status-bar">
           <span>Statut :</span>
           <span class="badge" id="statusBadge">En attente</span>
@@ -625,6 +1476,31 @@ const indexHTML = `<!doctype html>
       </header>
       <pre id="log">En attente d'un téléchargement...</pre>
     </section>
+    <section class="card">
+      <header>
+        <h2>Bibliothèque</h2>
+        <p class="description">Retrouvez et lisez les fichiers déjà téléchargés.</p>
+        <p class="description" id="storageInfo"></p>
+      </header>
+      <div class="library-tools">
+        <input type="text" id="libSearch" placeholder="Rechercher un fichier..." autocomplete="off" />
+        <select id="libKind">
+          <option value="">Tout</option>
+          <option value="video">Vidéos</option>
+          <option value="audio">Audio</option>
+        </select>
+        <select id="libSort">
+          <option value="date">Plus récents</option>
+          <option value="name">Nom</option>
+          <option value="size">Taille</option>
+          <option value="duration">Durée</option>
+        </select>
+        <button type="button" class="secondary" id="libRefresh">Actualiser</button>
+        <button type="button" class="secondary" id="libTrash">Corbeille</button>
+      </div>
+      <div class="library-player" id="libPlayer" hidden></div>
+      <ul class="library-list" id="libList"></ul>
+    </section>
   </main>
   <script>
     const downloadBtn = document.getElementById('downloadBtn');
@@ -636,19 +1512,215 @@ const indexHTML = `<!doctype html>
     const convertValue = document.getElementById('convertValue');
     const logEl = document.getElementById('log');
     const urlInput = document.getElementById('url');
-    const modeCards = document.querySelectorAll('.mode-card');
+    const modeSelector = document.getElementById('modeSelector');
+    const videoOptions = document.getElementById('videoOptions');
+    const audioOptions = document.getElementById('audioOptions');
+    const audioFormat = document.getElementById('audioFormat');
+    const audioQuality = document.getElementById('audioQuality');
+    const formatsBtn = document.getElementById('formatsBtn');
+    const formatSelect = document.getElementById('formatSelect');
 
     let activeJobId = null;
+    let activeBatchId = null;
+    let lastBatch = null;
+    const cancelBtn = document.getElementById('cancelBtn');
     let poller = null;
 
-    modeCards.forEach(card => {
-      card.addEventListener('click', () => {
-        modeCards.forEach(c => c.classList.remove('active'));
-        card.classList.add('active');
-        card.querySelector('input').checked = true;
+    function bindModeCards() {
+      const modeCards = modeSelector.querySelectorAll('.mode-card');
+      modeCards.forEach(card => {
+        card.addEventListener('click', () => {
+          modeCards.forEach(c => c.classList.remove('active'));
+          card.classList.add('active');
+          card.querySelector('input').checked = true;
+          refreshOptions();
+        });
       });
+      refreshOptions();
+    }
+
+    function selectedMode() {
+      const input = document.querySelector('input[name="mode"]:checked');
+      return input ? input.dataset.mode : 'video';
+    }
+
+    function canEmbedThumbnail() {
+      if (selectedMode() !== 'audio') return true;
+      return ['', 'mp3', 'm4a'].includes(audioFormat.value);
+    }
+
+    function refreshOptions() {
+      videoOptions.hidden = selectedMode() !== 'video';
+      audioOptions.hidden = selectedMode() !== 'audio';
+      document.getElementById('splitChaptersToggle').hidden = selectedMode() !== 'audio';
+      const lossless = audioFormat.value === 'flac' || audioFormat.value === 'wav';
+      audioQuality.disabled = lossless;
+      if (lossless) audioQuality.value = '';
+    }
+
+    audioFormat.addEventListener('change', refreshOptions);
+
+    const scopeSelect = document.getElementById('scope');
+    scopeSelect.addEventListener('change', () => {
+      document.querySelectorAll('.collection-only').forEach(el => {
+        el.hidden = scopeSelect.value === 'video';
+      });
+      document.querySelectorAll('.playlist-only').forEach(el => {
+        el.hidden = scopeSelect.value !== 'playlist';
+      });
+      document.querySelectorAll('.channel-only').forEach(el => {
+        el.hidden = scopeSelect.value !== 'channel';
+      });
+    });
+
+    function formatSize(bytes) {
+      if (!bytes) return '';
+      const units = ['o', 'Ko', 'Mo', 'Go'];
+      let value = bytes;
+      let unit = 0;
+      while (value >= 1024 && unit < units.length - 1) {
+        value /= 1024;
+        unit++;
+      }
+      return value.toFixed(unit ? 1 : 0) + ' ' + units[unit];
+    }
+
+    function describeFormat(f) {
+      const parts = [f.id, f.container];
+      if (f.resolution) parts.push(f.resolution + (f.fps ? ' ' + f.fps + ' i/s' : ''));
+      if (f.audioOnly) parts.push('audio seul');
+      if (f.videoOnly) parts.push('vidéo seule');
+      const codecs = [f.vcodec, f.acodec].filter(Boolean).join(' / ');
+      if (codecs) parts.push(codecs);
+      if (f.bitrate) parts.push(Math.round(f.bitrate) + ' kbit/s');
+      if (f.size) parts.push(formatSize(f.size));
+      return parts.join(' · ');
+    }
+
+    function resetFormats() {
+      formatSelect.innerHTML = '<option value="">Choix automatique</option>';
+      formatSelect.hidden = true;
+    }
+
+    formatsBtn.addEventListener('click', async () => {
+      const url = urlInput.value.trim();
+      if (!url) {
+        statusMessage.textContent = 'Veuillez entrer une URL valide.';
+        return;
+      }
+      formatsBtn.disabled = true;
+      formatsBtn.textContent = 'Analyse des formats...';
+      try {
+        const res = await fetch('/formats?url=' + encodeURIComponent(url));
+        const data = await res.json().catch(() => ({ ok: false }));
+        if (!data.ok) throw new Error(data.error || 'Formats indisponibles');
+        resetFormats();
+        data.formats.forEach(f => {
+          const opt = document.createElement('option');
+          opt.value = f.videoOnly && selectedMode() === 'video' ? f.id + '+bestaudio' : f.id;
+          opt.textContent = describeFormat(f);
+          formatSelect.appendChild(opt);
+        });
+        formatSelect.hidden = false;
+      } catch (err) {
+        console.error(err);
+        statusMessage.textContent = err.message;
+      } finally {
+        formatsBtn.disabled = false;
+        formatsBtn.textContent = 'Choisir un format précis…';
+      }
+    });
+
+    const preview = document.getElementById('preview');
+    const previewThumb = document.getElementById('previewThumb');
+    const previewTitle = document.getElementById('previewTitle');
+    const previewChannel = document.getElementById('previewChannel');
+    const previewMeta = document.getElementById('previewMeta');
+    const previewSubs = document.getElementById('previewSubs');
+    let previewTimer = null;
+    let previewSeq = 0;
+
+    function formatDuration(seconds) {
+      seconds = Math.round(seconds || 0);
+      const h = Math.floor(seconds / 3600);
+      const m = Math.floor((seconds % 3600) / 60);
+      const s = String(seconds % 60).padStart(2, '0');
+      return h ? h + ':' + String(m).padStart(2, '0') + ':' + s : m + ':' + s;
+    }
+
+    function looksLikeURL(value) {
+      return /^(https?:\/\/)?([\w-]+\.)+[a-z]{2,}\/\S+/i.test(value);
+    }
+
+    async function loadPreview(url) {
+      const seq = ++previewSeq;
+      try {
+        const res = await fetch('/info?url=' + encodeURIComponent(url));
+        const data = await res.json().catch(() => ({ ok: false }));
+        if (seq !== previewSeq) return;
+        if (!data.ok || !data.info) throw new Error(data.error || 'Aperçu indisponible');
+        const info = data.info;
+        previewThumb.src = info.thumbnail || '';
+        previewTitle.textContent = info.title;
+        previewChannel.textContent = info.channel || '';
+        const meta = [formatDuration(info.duration)];
+        if (info.uploadDate) meta.push(new Date(info.uploadDate).toLocaleDateString('fr-FR'));
+        if (info.viewCount) meta.push(info.viewCount.toLocaleString('fr-FR') + ' vues');
+        if (info.estimatedSize) meta.push('≈ ' + formatSize(info.estimatedSize));
+        previewMeta.textContent = meta.join(' · ');
+        const subs = [];
+        if (info.subtitles && info.subtitles.length) subs.push('Sous-titres : ' + info.subtitles.join(', '));
+        if (info.autoCaptions && info.autoCaptions.length) subs.push(info.autoCaptions.length + ' langues automatiques');
+        previewSubs.textContent = subs.join(' · ');
+        preview.hidden = false;
+      } catch (err) {
+        if (seq !== previewSeq) return;
+        console.error(err);
+        preview.hidden = true;
+      }
+    }
+
+    urlInput.addEventListener('input', () => {
+      resetFormats();
+      clearTimeout(previewTimer);
+      const url = urlInput.value.trim();
+      if (url.includes('\n') || !looksLikeURL(url)) {
+        previewSeq++;
+        preview.hidden = true;
+        return;
+      }
+      previewTimer = setTimeout(() => loadPreview(url), 600);
     });
 
+    async function loadPresets() {
+      try {
+        const res = await fetch('/presets');
+        if (!res.ok) throw new Error('Préréglages indisponibles');
+        const data = await res.json();
+        if (!data.ok || !data.presets || !data.presets.length) return;
+        modeSelector.innerHTML = '';
+        data.presets.forEach((preset, i) => {
+          const card = document.createElement('label');
+          card.className = 'mode-card' + (i === 0 ? ' active' : '');
+          const input = document.createElement('input');
+          input.type = 'radio';
+          input.name = 'mode';
+          input.value = preset.name;
+          input.dataset.mode = preset.mode;
+          input.checked = i === 0;
+          const title = document.createElement('h3');
+          title.textContent = preset.label;
+          const desc = document.createElement('span');
+          desc.textContent = preset.description || '';
+          card.append(input, title, desc);
+          modeSelector.appendChild(card);
+        });
+        bindModeCards();
+      } catch (err) {
+        console.error(err);
+      }
+    }
+
     function setBadge(status, tone = 'progress') {
       statusBadge.className = 'badge ' + tone;
       statusBadge.textContent = status;
@@ -686,8 +1758,15 @@ const indexHTML = `<!doctype html>
 
       if (job.status === 'terminé') {
         setBadge('Terminé', 'success');
+        if (job.archived) {
+          statusMessage.textContent = 'Déjà téléchargé : fichier existant réutilisé';
+        } else if (job.result && job.result.quality && job.result.quality.summary) {
+          statusMessage.textContent = 'Qualité : ' + job.result.quality.summary;
+        }
       } else if (job.status === 'erreur') {
         setBadge('Erreur', 'error');
+      } else if (job.status === 'annulé') {
+        setBadge('Annulé', 'error');
       } else {
         setBadge(job.status, 'progress');
       }
@@ -699,7 +1778,267 @@ const indexHTML = `<!doctype html>
         poller = null;
       }
       activeJobId = null;
+      activeBatchId = null;
+      lastBatch = null;
       downloadBtn.disabled = false;
+      cancelBtn.hidden = true;
+      loadLibrary();
+    }
+
+    cancelBtn.addEventListener('click', async () => {
+      let ids = activeJobId ? [activeJobId] : [];
+      if (activeBatchId && lastBatch) {
+        ids = lastBatch.items.filter(item => item.jobId && !item.finished).map(item => item.jobId);
+      }
+      cancelBtn.disabled = true;
+      await Promise.all(ids.map(id => fetch('/cancel?id=' + encodeURIComponent(id), { method: 'POST' }).catch(console.error)));
+      cancelBtn.disabled = false;
+      statusMessage.textContent = 'Annulation demandée...';
+    });
+
+    const libList = document.getElementById('libList');
+    const libPlayer = document.getElementById('libPlayer');
+    const libSearch = document.getElementById('libSearch');
+    let libTimer = null;
+    let libFolders = [];
+
+    async function loadLibrary() {
+      const params = new URLSearchParams({
+        q: libSearch.value.trim(),
+        kind: document.getElementById('libKind').value,
+        sort: document.getElementById('libSort').value
+      });
+      try {
+        const res = await fetch('/library?' + params);
+        const data = await res.json();
+        if (!data.ok) throw new Error(data.error || 'Bibliothèque indisponible');
+        libFolders = data.folders || [];
+        renderLibrary(data.items || []);
+        loadStorage();
+      } catch (err) {
+        console.error(err);
+        libList.textContent = 'Bibliothèque indisponible.';
+      }
+    }
+
+    async function loadStorage() {
+      const info = document.getElementById('storageInfo');
+      try {
+        const res = await fetch('/storage');
+        const data = await res.json();
+        if (!data.ok || !data.usage) throw new Error(data.error || 'Espace inconnu');
+        const u = data.usage;
+        let text = 'Espace utilisé : ' + (formatSize(u.used) || '0 o');
+        if (u.quota) text += ' sur ' + formatSize(u.quota) + ' de quota';
+        info.textContent = text + ' · ' + formatSize(u.free) + ' libres sur le disque';
+      } catch (err) {
+        console.error(err);
+        info.textContent = '';
+      }
+    }
+
+    function describeItem(item) {
+      const parts = [item.folder, formatSize(item.size)];
+      if (item.duration) parts.push(formatDuration(item.duration));
+      if (item.height) parts.push(item.height + 'p');
+      parts.push(item.videoCodec || item.audioCodec || '');
+      return parts.filter(Boolean).join(' · ');
+    }
+
+    function renderLibrary(items) {
+      libList.innerHTML = '';
+      if (!items.length) {
+        libList.textContent = 'Aucun fichier.';
+        return;
+      }
+      items.forEach(item => {
+        const li = document.createElement('li');
+        const info = document.createElement('div');
+        const name = document.createElement('div');
+        name.textContent = item.title || item.name;
+        name.title = item.relPath;
+        const meta = document.createElement('div');
+        meta.className = 'meta';
+        meta.textContent = describeItem(item);
+        info.append(name, meta);
+        const actions = document.createElement('div');
+        actions.append(libraryButton('Lire', () => playItem(item)));
+        actions.append(libraryButton('Renommer', () => renameItem(item)));
+        if (libFolders.length > 1) actions.append(libraryButton('Déplacer', () => moveItem(item)));
+        if (item.kind === 'audio') actions.append(libraryButton('Étiquettes', () => retagItem(item)));
+        actions.append(libraryButton('Supprimer', () => deleteItem(item)));
+        li.append(info, actions);
+        libList.appendChild(li);
+      });
+    }
+
+    function libraryButton(label, onClick) {
+      const button = document.createElement('button');
+      button.type = 'button';
+      button.className = 'secondary';
+      button.textContent = label;
+      button.addEventListener('click', onClick);
+      return button;
+    }
+
+    async function libraryAction(action, body) {
+      try {
+        const res = await fetch('/library/' + action, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify(body)
+        });
+        if (!res.ok) throw new Error(await errorText(res) || 'Opération impossible');
+      } catch (err) {
+        console.error(err);
+        alert(err.message);
+      }
+      loadLibrary();
+    }
+
+    function renameItem(item) {
+      const name = prompt('Nouveau nom du fichier :', item.name.replace(/\.[^.]+$/, ''));
+      if (name && name.trim()) libraryAction('rename', { id: item.id, name: name.trim() });
+    }
+
+    function moveItem(item) {
+      const others = libFolders.filter(f => f !== item.folder);
+      const folder = prompt('Dossier de destination (' + others.join(', ') + ') :', others[0] || '');
+      if (folder) libraryAction('move', { id: item.id, folder: folder.trim() });
+    }
+
+    function retagItem(item) {
+      const tags = {};
+      for (const [key, label] of [['title', 'Titre'], ['artist', 'Artiste'], ['album', 'Album']]) {
+        const value = prompt(label + ' (laisser vide pour effacer, Annuler pour conserver) :', key === 'title' ? (item.title || '') : '');
+        if (value !== null) tags[key] = value;
+      }
+      if (Object.keys(tags).length) libraryAction('tags', { id: item.id, tags });
+    }
+
+    function deleteItem(item) {
+      if (confirm('Placer « ' + item.name + ' » dans la corbeille ?')) {
+        if (libPlayer.querySelector('[src="/library/file/' + item.id + '"]')) {
+          libPlayer.innerHTML = '';
+          libPlayer.hidden = true;
+        }
+        libraryAction('delete', { id: item.id });
+      }
+    }
+
+    async function loadTrash() {
+      try {
+        const res = await fetch('/library/trash');
+        const data = await res.json();
+        if (!data.ok) throw new Error(data.error || 'Corbeille indisponible');
+        renderTrash(data.entries || []);
+      } catch (err) {
+        console.error(err);
+        libList.textContent = 'Corbeille indisponible.';
+      }
+    }
+
+    function renderTrash(entries) {
+      libList.innerHTML = '';
+      if (!entries.length) {
+        libList.textContent = 'La corbeille est vide.';
+        return;
+      }
+      entries.forEach(entry => {
+        const li = document.createElement('li');
+        const info = document.createElement('div');
+        const name = document.createElement('div');
+        name.textContent = entry.originalPath.split(/[\\/]/).pop();
+        name.title = entry.originalPath;
+        const meta = document.createElement('div');
+        meta.className = 'meta';
+        meta.textContent = ['Supprimé le ' + new Date(entry.deletedAt).toLocaleString(), formatSize(entry.size)].filter(Boolean).join(' · ');
+        info.append(name, meta);
+        const actions = document.createElement('div');
+        actions.append(libraryButton('Restaurer', () => restoreItem(entry)));
+        li.append(info, actions);
+        libList.appendChild(li);
+      });
+    }
+
+    async function restoreItem(entry) {
+      try {
+        const res = await fetch('/library/restore', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ name: entry.name })
+        });
+        if (!res.ok) throw new Error(await errorText(res) || 'Restauration impossible');
+      } catch (err) {
+        console.error(err);
+        alert(err.message);
+      }
+      loadTrash();
+    }
+
+    function playItem(item) {
+      const media = document.createElement(item.kind === 'video' ? 'video' : 'audio');
+      media.controls = true;
+      media.autoplay = true;
+      media.src = '/library/file/' + item.id;
+      libPlayer.innerHTML = '';
+      libPlayer.appendChild(media);
+      libPlayer.hidden = false;
+    }
+
+    libSearch.addEventListener('input', () => {
+      clearTimeout(libTimer);
+      libTimer = setTimeout(loadLibrary, 300);
+    });
+    document.getElementById('libKind').addEventListener('change', loadLibrary);
+    document.getElementById('libSort').addEventListener('change', loadLibrary);
+    document.getElementById('libRefresh').addEventListener('click', loadLibrary);
+    document.getElementById('libTrash').addEventListener('click', loadTrash);
+
+    // errorText lit le message d'une réponse en échec, JSON structuré ou texte brut.
+    async function errorText(res) {
+      const text = (await res.text()).trim();
+      try {
+        const data = JSON.parse(text);
+        if (data && data.error) return data.error;
+      } catch (e) {}
+      return text;
+    }
+
+    function describeBatch(batch) {
+      return batch.items.map((item, i) => {
+        const label = (i + 1) + '. ' + (item.title || item.url);
+        if (item.error) return label + ' — refusée : ' + item.error;
+        if (item.duplicate === 'archived') return label + ' — déjà téléchargée';
+        return label + ' — ' + (item.status || 'en attente') + (item.finished ? '' : ' (' + Math.round(item.downloadPct) + '%)');
+      }).join('\n');
+    }
+
+    async function pollBatch() {
+      if (!activeBatchId) return;
+      try {
+        const res = await fetch('/batches/' + activeBatchId);
+        if (!res.ok) throw new Error('Statut indisponible');
+        const data = await res.json();
+        if (!data.ok || !data.batch) throw new Error(data.error || 'Réponse invalide');
+        const batch = data.batch;
+        lastBatch = batch;
+        const c = batch.counts;
+        updateProgress({
+          status: batch.finished ? (c.failed === c.total ? 'erreur' : 'terminé') : 'lot en cours',
+          downloadPct: batch.downloadPct,
+          conversionPct: batch.finished ? 100 : -1,
+          log: describeBatch(batch)
+        });
+        statusMessage.textContent = c.done + ' terminés, ' + c.failed + ' en échec, ' + c.running + ' en cours'
+          + (c.invalid ? ', ' + c.invalid + ' URL refusées' : '');
+        if (batch.finished) {
+          stopPolling();
+        }
+      } catch (err) {
+        console.error(err);
+        statusMessage.textContent = 'Impossible de rafraîchir le statut';
+      }
     }
 
     async function pollStatus() {
@@ -719,17 +2058,82 @@ const indexHTML = `<!doctype html>
       }
     }
 
+    function buildRequest(url, preset) {
+      const body = { url, preset, scope: scopeSelect.value };
+      if (scopeSelect.value !== 'video') {
+        body.playlistItems = document.getElementById('playlistItems').value.trim();
+        body.continueOnError = document.getElementById('onError').value === 'continue';
+      }
+      if (scopeSelect.value === 'channel') {
+        body.dateAfter = document.getElementById('dateAfter').value;
+        body.dateBefore = document.getElementById('dateBefore').value;
+        body.maxItems = Number(document.getElementById('maxItems').value) || 0;
+        body.minDuration = document.getElementById('minDuration').value.trim();
+        body.maxDuration = document.getElementById('maxDuration').value.trim();
+        body.includeShorts = document.getElementById('includeShorts').checked;
+      }
+      if (formatSelect.value) {
+        body.formatId = formatSelect.value;
+      }
+      const embedThumbnail = document.getElementById('embedThumbnail').checked;
+      body.embedMetadata = document.getElementById('embedMetadata').checked;
+      body.embedThumbnail = embedThumbnail && canEmbedThumbnail();
+      body.splitArtist = document.getElementById('splitArtist').checked;
+      body.splitChapters = selectedMode() === 'audio' && document.getElementById('splitChapters').checked;
+      body.force = document.getElementById('force').checked;
+      body.collision = document.getElementById('collision').value;
+      body.tags = {
+        artist: document.getElementById('tagArtist').value.trim(),
+        album: document.getElementById('tagAlbum').value.trim()
+      };
+      body.start = document.getElementById('clipStart').value.trim();
+      body.end = document.getElementById('clipEnd').value.trim();
+      body.loudnessTarget = Number(document.getElementById('loudness').value) || 0;
+      const sponsorBlock = document.getElementById('sponsorBlock').value;
+      if (sponsorBlock) {
+        body.sponsorBlock = { action: sponsorBlock };
+      }
+      const languages = document.getElementById('subLangs').value.split(',').map(l => l.trim()).filter(Boolean);
+      if (languages.length) {
+        const kind = document.getElementById('subKind').value;
+        body.subtitles = {
+          languages,
+          manual: kind !== 'auto',
+          auto: kind !== 'manual',
+          embed: selectedMode() === 'video' && document.getElementById('subEmbed').value === 'embed'
+        };
+      }
+      if (selectedMode() === 'audio') {
+        body.audioFormat = audioFormat.value;
+        body.audioQuality = audioQuality.value;
+      } else {
+        body.maxHeight = Number(document.getElementById('maxHeight').value) || 0;
+        body.videoCodec = document.getElementById('videoCodec').value;
+        body.maxFps = Number(document.getElementById('maxFps').value) || 0;
+        body.hdr = document.getElementById('hdr').value;
+      }
+      return body;
+    }
+
     downloadBtn.addEventListener('click', async () => {
-      const url = urlInput.value.trim();
-      const mode = document.querySelector('input[name="mode"]:checked').value;
+      const lines = urlInput.value.split('\n').map(l => l.trim()).filter(Boolean);
+      const url = lines.length === 1 ? lines[0] : '';
+      const preset = document.querySelector('input[name="mode"]:checked').value;
 
-      if (!url) {
+      if (!lines.length) {
         statusMessage.textContent = 'Veuillez entrer une URL valide.';
         setBadge('URL manquante', 'error');
         return;
       }
 
+      const body = buildRequest(url, preset);
+      if (lines.length > 1) {
+        delete body.url;
+        body.urls = lines;
+      }
+
       downloadBtn.disabled = true;
+      cancelBtn.hidden = false;
       setBadge('Initialisation');
       statusMessage.textContent = 'Préparation du téléchargement...';
       downloadFill.style.width = '0%';
@@ -741,10 +2145,16 @@ const indexHTML = `<!doctype html>
         const res = await fetch('/download', {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify({ url, mode })
+          body: JSON.stringify(body)
         });
-        if (!res.ok) throw new Error('Téléchargement impossible');
+        if (!res.ok) throw new Error(await errorText(res) || 'Téléchargement impossible');
         const data = await res.json();
+        if (data.ok && data.batchId) {
+          activeBatchId = data.batchId;
+          pollBatch();
+          poller = setInterval(pollBatch, 1500);
+          return;
+        }
         if (!data.ok || !data.id) throw new Error(data.error || 'Réponse invalide');
         activeJobId = data.id;
         pollStatus();
@@ -754,10 +2164,14 @@ const indexHTML = `<!doctype html>
         setBadge('Erreur', 'error');
         statusMessage.textContent = err.message;
         downloadBtn.disabled = false;
+        cancelBtn.hidden = true;
       }
     });
 
+    bindModeCards();
+    loadPresets();
     resetUI();
+    loadLibrary();
   </script>
 </body>
 </html>`
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Codes renvoyés au client quand une URL est refusée par la politique.
+const (
+	policyInvalidURL     = "invalid_url"
+	policySchemeDenied   = "scheme_not_allowed"
+	policyHostDenied     = "host_denied"
+	policyHostNotAllowed = "host_not_allowed"
+	policyYouTubeOnly    = "youtube_only"
+)
+
+var defaultAllowedSchemes = []string{"http", "https"}
+
+// urlPolicy restreint les URL transmises au téléchargeur. Les motifs sont
+// comparés à l'hôte tel que saisi et à sa forme sans www., m., music. ou
+// gaming.: "example.com" couvre donc aussi www.example.com, tandis que
+// "www.example.com" ne vise que cet hôte. Les jokers sont acceptés:
+// "*.example.com" couvre a.b.example.com mais pas example.com, à lister à
+// part. La liste d'exclusion l'emporte sur la liste d'autorisation, et une
+// liste d'autorisation vide laisse passer tout hôte.
+type urlPolicy struct {
+	Schemes     []string `json:"schemes"`
+	AllowHosts  []string `json:"allowHosts"`
+	DenyHosts   []string `json:"denyHosts"`
+	YouTubeOnly bool     `json:"youtubeOnly"`
+}
+
+// policyError décrit un refus, avec un code stable exploitable par l'interface.
+type policyError struct {
+	Code    string
+	Message string
+}
+
+func (e *policyError) Error() string { return e.Message }
+
+var policy urlPolicy
+
+func loadURLPolicy(p urlPolicy) urlPolicy {
+	if len(p.Schemes) == 0 {
+		p.Schemes = defaultAllowedSchemes
+	}
+	p.Schemes = lowerAll(p.Schemes)
+	p.AllowHosts = validHostPatterns(lowerAll(p.AllowHosts))
+	p.DenyHosts = validHostPatterns(lowerAll(p.DenyHosts))
+	return p
+}
+
+func lowerAll(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func validHostPatterns(patterns []string) []string {
+	var out []string
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			log.Printf("Motif d'hôte %q ignoré: %v\n", p, err)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// check analyse l'URL et vérifie qu'elle respecte la politique; l'analyse
+// est renvoyée pour éviter à l'appelant de la refaire.
+func (p urlPolicy) check(raw string) (*videoURL, error) {
+	parsed, err := parseVideoURL(raw)
+	if err != nil {
+		return nil, &policyError{Code: policyInvalidURL, Message: err.Error()}
+	}
+	u, err := url.Parse(parsed.Normalized)
+	if err != nil {
+		return nil, &policyError{Code: policyInvalidURL, Message: fmt.Sprintf("URL %q illisible", parsed.Original)}
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !containsString(p.Schemes, scheme) {
+		return nil, &policyError{Code: policySchemeDenied, Message: fmt.Sprintf("schéma %q non autorisé", scheme)}
+	}
+	if p.YouTubeOnly && parsed.Kind == urlKindExternal {
+		return nil, &policyError{Code: policyYouTubeOnly, Message: "seules les URL YouTube sont acceptées"}
+	}
+	host := parsed.host
+	if matchHost(p.DenyHosts, host) {
+		return nil, &policyError{Code: policyHostDenied, Message: fmt.Sprintf("le site %s est exclu", host)}
+	}
+	if len(p.AllowHosts) > 0 && !matchHost(p.AllowHosts, host) {
+		return nil, &policyError{Code: policyHostNotAllowed, Message: fmt.Sprintf("le site %s n'est pas autorisé", host)}
+	}
+	return parsed, nil
+}
+
+// matchHost compare les motifs à l'hôte saisi puis à sa forme canonique.
+func matchHost(patterns []string, host string) bool {
+	candidates := []string{host}
+	if canonical := canonicalHost(host); canonical != host {
+		candidates = append(candidates, canonical)
+	}
+	for _, p := range patterns {
+		for _, h := range candidates {
+			if ok, _ := path.Match(p, h); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyCode extrait le code d'un refus de la politique, vide pour les autres erreurs.
+func policyCode(err error) string {
+	if pe, ok := err.(*policyError); ok {
+		return pe.Code
+	}
+	return ""
+}
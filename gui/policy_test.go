@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestURLPolicyCheck(t *testing.T) {
+	const watch = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+
+	tests := []struct {
+		name   string
+		policy urlPolicy
+		raw    string
+		code   string
+	}{
+		{name: "sans règle", raw: watch},
+		{name: "autorisé exact", policy: urlPolicy{AllowHosts: []string{"www.youtube.com"}}, raw: watch},
+		{name: "autorisé sans www", policy: urlPolicy{AllowHosts: []string{"www.youtube.com"}}, raw: "https://youtube.com/watch?v=dQw4w9WgXcQ", code: policyHostNotAllowed},
+		{name: "autorisé youtu.be", policy: urlPolicy{AllowHosts: []string{"youtu.be"}}, raw: "https://youtu.be/dQw4w9WgXcQ"},
+		{name: "joker", policy: urlPolicy{AllowHosts: []string{"*.youtube.com"}}, raw: watch},
+		{name: "joker sans le domaine nu", policy: urlPolicy{AllowHosts: []string{"*.example.com"}}, raw: "https://example.com/v", code: policyHostNotAllowed},
+		{name: "hôte en majuscules", policy: urlPolicy{AllowHosts: []string{"WWW.YouTube.com"}}, raw: "https://WWW.YOUTUBE.COM./watch?v=dQw4w9WgXcQ"},
+		{name: "exclu www", policy: urlPolicy{DenyHosts: []string{"www.example.com"}}, raw: "https://www.example.com/v", code: policyHostDenied},
+		{name: "exclu m", policy: urlPolicy{DenyHosts: []string{"m.example.com"}}, raw: "https://m.example.com/v", code: policyHostDenied},
+		{name: "exclu via www", policy: urlPolicy{DenyHosts: []string{"youtube.com"}}, raw: watch, code: policyHostDenied},
+		{name: "exclu via m", policy: urlPolicy{DenyHosts: []string{"youtube.com"}}, raw: "https://m.youtube.com/watch?v=dQw4w9WgXcQ", code: policyHostDenied},
+		{name: "exclu via www hors YouTube", policy: urlPolicy{DenyHosts: []string{"example.com"}}, raw: "https://www.example.com/v", code: policyHostDenied},
+		{name: "autorisé via www", policy: urlPolicy{AllowHosts: []string{"youtube.com"}}, raw: watch},
+		{name: "autorisé via music", policy: urlPolicy{AllowHosts: []string{"youtube.com"}}, raw: "https://music.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{name: "exclusion prioritaire", policy: urlPolicy{AllowHosts: []string{"*.example.com"}, DenyHosts: []string{"bad.example.com"}}, raw: "https://bad.example.com/v", code: policyHostDenied},
+		{name: "schéma refusé", raw: "ftp://example.com/v", code: policySchemeDenied},
+		{name: "YouTube seulement", policy: urlPolicy{YouTubeOnly: true}, raw: "https://vimeo.com/76979871", code: policyYouTubeOnly},
+		{name: "URL invalide", raw: "https://www.youtube.com/watch", code: policyInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadURLPolicy(tt.policy)
+			_, err := p.check(tt.raw)
+			if code := policyCode(err); code != tt.code {
+				t.Errorf("check(%q) = %q (%v), attendu %q", tt.raw, code, err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// postProcess applique les traitements locaux aux fichiers produits, une fois
+// le téléchargeur terminé.
+func postProcess(ctx context.Context, job *job, info *videoInfo, result *jobResult) error {
+	if len(result.Files) == 0 {
+		return nil
+	}
+	if r := job.opts.Range; r != nil {
+		result.Range = r
+		if !backendSupports("--download-sections") {
+			job.appendLog(fmt.Sprintf("Découpe de l'extrait %s - %s...", formatClock(r.Start), rangeEndLabel(r)))
+			if err := trimToRange(ctx, result.Files[0], r); err != nil {
+				return fmt.Errorf("découpe de l'extrait: %w", err)
+			}
+		}
+	}
+	if target := job.preset.LoudnessTarget; target != 0 {
+		job.update(func(s *jobStatus) { s.Status = "normalisation" })
+		for _, file := range result.Files {
+			job.appendLog(fmt.Sprintf("Normalisation de la sonie vers %.1f LUFS...", target))
+			report, err := normalizeLoudness(ctx, file, target, job.preset)
+			if err != nil {
+				return fmt.Errorf("normalisation de la sonie: %w", err)
+			}
+			job.appendLog(fmt.Sprintf("Sonie: %.1f LUFS avant, %.1f LUFS après", report.Before, report.After))
+			result.Loudness = append(result.Loudness, *report)
+		}
+	}
+	tags := buildTags(job.opts, info)
+	if len(tags) > 0 {
+		job.appendLog("Écriture des étiquettes...")
+		for _, file := range result.Files {
+			if err := writeTags(ctx, file, tags); err != nil {
+				return fmt.Errorf("étiquettes: %w", err)
+			}
+		}
+	}
+	if err := finalizeOutput(job, info, result); err != nil {
+		return err
+	}
+	if result.Skipped {
+		return nil
+	}
+	// Les fichiers portent désormais leur nom définitif: en cas d'échec, ils
+	// restent en place et le journal indique où les trouver.
+	if job.preset.Mode == "audio" && job.opts.Range == nil && info != nil && len(info.Chapters) > 0 {
+		if err := processChapters(ctx, job, info, tags, result); err != nil {
+			keptOutputs(job, result)
+			return err
+		}
+	}
+	if err := runHooks(ctx, job, result); err != nil {
+		keptOutputs(job, result)
+		return err
+	}
+	return nil
+}
+
+func keptOutputs(job *job, result *jobResult) {
+	for _, f := range result.Files {
+		job.appendLog(fmt.Sprintf("Fichier conservé malgré l'échec: %s", f))
+	}
+}
+
+func processChapters(ctx context.Context, job *job, info *videoInfo, tags map[string]string, result *jobResult) error {
+	if job.opts.SplitChapters {
+		job.appendLog(fmt.Sprintf("Découpage en %d pistes...", len(info.Chapters)))
+		files, err := splitByChapters(ctx, job, result.Files[0], info, tags)
+		if err != nil {
+			return fmt.Errorf("découpage par chapitres: %w", err)
+		}
+		result.Files = files
+		return nil
+	}
+	job.appendLog(fmt.Sprintf("Intégration de %d chapitres...", len(info.Chapters)))
+	if err := embedChapters(ctx, result.Files[0], info.Chapters); err != nil {
+		job.appendLog(fmt.Sprintf("Chapitres non intégrés: %v", err))
+	}
+	return nil
+}
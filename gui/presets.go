@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const defaultOutputTemplate = "%(title)s.%(ext)s"
+
+// preset décrit un profil de téléchargement nommé: sélecteur de format,
+// conteneur, conversion audio, post-traitements et modèle de nom de fichier.
+type preset struct {
+	Name           string   `json:"name"`
+	Label          string   `json:"label"`
+	Description    string   `json:"description,omitempty"`
+	Mode           string   `json:"mode"`
+	Format         string   `json:"format"`
+	Container      string   `json:"container,omitempty"`
+	MaxHeight      int      `json:"maxHeight,omitempty"`
+	VideoCodec     string   `json:"videoCodec,omitempty"`
+	MaxFPS         int      `json:"maxFps,omitempty"`
+	HDR            string   `json:"hdr,omitempty"`
+	AudioCodec     string   `json:"audioCodec,omitempty"`
+	AudioQuality   string   `json:"audioQuality,omitempty"`
+	PostProcessors []string `json:"postProcessors,omitempty"`
+	OutputTemplate string   `json:"outputTemplate,omitempty"`
+
+	SponsorBlock   *sponsorBlockOptions `json:"sponsorBlock,omitempty"`
+	LoudnessTarget float64              `json:"loudnessTarget,omitempty"`
+}
+
+type presetsResponse struct {
+	OK      bool     `json:"ok"`
+	Presets []preset `json:"presets"`
+}
+
+var presets []preset
+
+func builtinPresets() []preset {
+	return []preset{
+		{
+			Name:        "video",
+			Label:       "Vidéo + Audio",
+			Description: "MP4 optimisé (jusqu'à 1080p) avec fusion automatique.",
+			Mode:        "video",
+			Format:      "bestvideo[ext=mp4][vcodec!*=av01]+bestaudio[ext=m4a]/best[ext=mp4][vcodec!*=av01]/best[ext=mp4]/best",
+			Container:   "mp4",
+		},
+		{
+			Name:         "audio",
+			Label:        "Audio seul",
+			Description:  "Extraction MP3 haute qualité idéale pour les podcasts & musique.",
+			Mode:         "audio",
+			Format:       "bestaudio/best",
+			AudioCodec:   "mp3",
+			AudioQuality: "0",
+		},
+	}
+}
+
+// loadPresets fusionne les préréglages intégrés avec ceux de la configuration;
+// un préréglage configuré portant le nom d'un intégré le remplace.
+func loadPresets(configured []preset) []preset {
+	list := builtinPresets()
+	for _, p := range configured {
+		if err := validatePreset(&p); err != nil {
+			log.Printf("Préréglage %q ignoré: %v\n", p.Name, err)
+			continue
+		}
+		replaced := false
+		for i := range list {
+			if list[i].Name == p.Name {
+				list[i] = p
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+func validatePreset(p *preset) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("nom manquant")
+	}
+	if p.Label == "" {
+		p.Label = p.Name
+	}
+	switch p.Mode {
+	case "audio", "video":
+	default:
+		return fmt.Errorf("mode %q inconnu", p.Mode)
+	}
+	for _, arg := range p.PostProcessors {
+		if !strings.HasPrefix(arg, "--") {
+			return fmt.Errorf("post-traitement %q invalide", arg)
+		}
+	}
+	if err := validateLoudnessTarget(p.LoudnessTarget); err != nil {
+		return err
+	}
+	return validateSponsorBlock(p.SponsorBlock)
+}
+
+func presetByName(name string) (preset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return preset{}, false
+}
+
+// resolvePreset choisit le préréglage d'un travail; sans nom explicite,
+// l'ancien champ mode désigne le préréglage intégré équivalent.
+func resolvePreset(name, mode string) (preset, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = normalizeMode(mode)
+	}
+	p, ok := presetByName(name)
+	if !ok {
+		return preset{}, fmt.Errorf("préréglage %q inconnu", name)
+	}
+	return p, nil
+}
+
+func presetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(presetsResponse{OK: true, Presets: presets})
+}
+
+func outputTemplate(p preset) string {
+	if p.OutputTemplate == "" {
+		return defaultOutputTemplate
+	}
+	return p.OutputTemplate
+}
+
+func presetArgs(p preset) []string {
+	args := []string{"--newline", "--write-info-json", "-o", outputTemplate(p)}
+	format := p.Format
+	if p.Mode == "video" && hasVideoConstraints(p) {
+		format = videoFormatSelector(p)
+	}
+	if format != "" {
+		args = append(args, "-f", format)
+	}
+	if p.Mode == "audio" {
+		args = append(args, "--extract-audio")
+		if p.AudioCodec != "" {
+			args = append(args, "--audio-format", p.AudioCodec)
+		}
+		if p.AudioQuality != "" {
+			args = append(args, "--audio-quality", p.AudioQuality)
+		}
+	} else if p.Container != "" {
+		args = append(args, "--merge-output-format", p.Container)
+	}
+	return append(args, p.PostProcessors...)
+}
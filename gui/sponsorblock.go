@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var sponsorBlockCategories = []string{"sponsor", "intro", "outro", "selfpromo", "preview", "interaction", "music_offtopic", "filler"}
+
+var defaultSponsorBlockCategories = []string{"sponsor", "intro", "outro", "selfpromo"}
+
+// sponsorBlockOptions choisit de couper (remove) ou de marquer en chapitres
+// (mark) les segments SponsorBlock des catégories indiquées.
+type sponsorBlockOptions struct {
+	Action     string   `json:"action"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+type sponsorSegment struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Category  string  `json:"category"`
+}
+
+// sponsorBlockReport résume les segments traités pour le statut du travail.
+type sponsorBlockReport struct {
+	Action     string             `json:"action"`
+	Supported  bool               `json:"supported"`
+	Segments   int                `json:"segments"`
+	Seconds    float64            `json:"seconds"`
+	ByCategory map[string]float64 `json:"byCategory,omitempty"`
+}
+
+// resolveSponsorBlock combine le réglage du préréglage et celui du travail;
+// sans catégories explicites, le travail reprend celles du préréglage.
+func resolveSponsorBlock(p preset, requested *sponsorBlockOptions) (*sponsorBlockOptions, error) {
+	var opts *sponsorBlockOptions
+	if p.SponsorBlock != nil {
+		copied := *p.SponsorBlock
+		opts = &copied
+	}
+	if requested != nil {
+		copied := *requested
+		if len(copied.Categories) == 0 && opts != nil {
+			copied.Categories = opts.Categories
+		}
+		opts = &copied
+	}
+	if opts == nil {
+		return nil, nil
+	}
+	opts.Categories = append([]string(nil), opts.Categories...)
+	return opts, validateSponsorBlock(opts)
+}
+
+func validateSponsorBlock(opts *sponsorBlockOptions) error {
+	if opts == nil {
+		return nil
+	}
+	opts.Action = strings.ToLower(strings.TrimSpace(opts.Action))
+	if opts.Action != "remove" && opts.Action != "mark" {
+		return fmt.Errorf("action SponsorBlock %q invalide (remove, mark)", opts.Action)
+	}
+	for i, c := range opts.Categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "self-promo" {
+			c = "selfpromo"
+		}
+		known := false
+		for _, k := range sponsorBlockCategories {
+			if c == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("catégorie SponsorBlock %q inconnue", c)
+		}
+		opts.Categories[i] = c
+	}
+	return nil
+}
+
+func (o *sponsorBlockOptions) categories() []string {
+	if len(o.Categories) == 0 {
+		return defaultSponsorBlockCategories
+	}
+	return o.Categories
+}
+
+func sponsorBlockArgs(job *job) []string {
+	opts := job.opts.SponsorBlock
+	if opts == nil {
+		return nil
+	}
+	flag := "--sponsorblock-" + opts.Action
+	if !backendSupports(flag) {
+		job.appendLog("SponsorBlock ignoré: le téléchargeur installé ne le prend pas en charge")
+		return nil
+	}
+	return []string{flag, strings.Join(opts.categories(), ",")}
+}
+
+// sponsorBlockSummary totalise la durée des segments retenus d'après les
+// informations écrites par le téléchargeur.
+func sponsorBlockSummary(opts *sponsorBlockOptions, segments []sponsorSegment) *sponsorBlockReport {
+	report := &sponsorBlockReport{
+		Action:     opts.Action,
+		Supported:  backendSupports("--sponsorblock-" + opts.Action),
+		ByCategory: make(map[string]float64),
+	}
+	if !report.Supported {
+		return report
+	}
+	wanted := make(map[string]bool)
+	for _, c := range opts.categories() {
+		wanted[c] = true
+	}
+	for _, seg := range segments {
+		if !wanted[seg.Category] || seg.EndTime <= seg.StartTime {
+			continue
+		}
+		d := seg.EndTime - seg.StartTime
+		report.Segments++
+		report.Seconds += d
+		report.ByCategory[seg.Category] += d
+	}
+	return report
+}
+
+func (r *sponsorBlockReport) String() string {
+	if !r.Supported {
+		return "SponsorBlock: non pris en charge par le téléchargeur"
+	}
+	verb := "retirés"
+	if r.Action == "mark" {
+		verb = "marqués"
+	}
+	if r.Segments == 0 {
+		return "SponsorBlock: aucun segment " + strings.TrimSuffix(verb, "s")
+	}
+	cats := make([]string, 0, len(r.ByCategory))
+	for c := range r.ByCategory {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	parts := make([]string, 0, len(cats))
+	for _, c := range cats {
+		parts = append(parts, fmt.Sprintf("%s %.1fs", c, r.ByCategory[c]))
+	}
+	return fmt.Sprintf("SponsorBlock: %d segments %s, %.1fs au total (%s)", r.Segments, verb, r.Seconds, strings.Join(parts, ", "))
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMarginMB    = 200
+	spaceRetryInterval = 30 * time.Second
+	spaceQueueTimeout  = 30 * time.Minute
+)
+
+// storageConfig encadre l'espace occupé par les téléchargements. WhenFull
+// vaut "reject" (par défaut) pour refuser un travail faute de place, ou
+// "queue" pour le mettre en attente jusqu'à ce que la place se libère.
+type storageConfig struct {
+	QuotaMB     int64  `json:"quotaMB"`
+	PruneOldest bool   `json:"pruneOldest"`
+	MarginMB    int64  `json:"marginMB"`
+	WhenFull    string `json:"whenFull"`
+}
+
+type storageUsage struct {
+	Dir      string `json:"dir"`
+	Free     uint64 `json:"free"`
+	Total    uint64 `json:"total"`
+	Used     int64  `json:"used"`
+	Files    int    `json:"files"`
+	Quota    int64  `json:"quota,omitempty"`
+	Reserved int64  `json:"reserved"`
+	Margin   int64  `json:"margin"`
+}
+
+type storageResponse struct {
+	OK    bool          `json:"ok"`
+	Usage *storageUsage `json:"usage,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// storedFile est un fichier multimédia du dossier de téléchargement.
+type storedFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+var (
+	storage storageConfig
+	// reserveMu protège reserved, la place promise aux travaux en cours.
+	reserveMu sync.Mutex
+	reserved  int64
+)
+
+func loadStorage(c storageConfig) storageConfig {
+	if c.MarginMB <= 0 {
+		c.MarginMB = defaultMarginMB
+	}
+	switch c.WhenFull {
+	case "":
+		c.WhenFull = "reject"
+	case "reject", "queue":
+	default:
+		log.Printf("Politique d'espace %q inconnue, refus appliqué\n", c.WhenFull)
+		c.WhenFull = "reject"
+	}
+	if c.QuotaMB < 0 {
+		c.QuotaMB = 0
+	}
+	return c
+}
+
+// spaceReservation est la place promise à un travail. Elle part de
+// l'estimation connue avant le lancement, puis est ajustée une fois que le
+// téléchargeur a choisi les formats qu'il télécharge réellement.
+type spaceReservation struct {
+	mu       sync.Mutex
+	need     int64
+	adjusted bool
+}
+
+// reserveSpace vérifie, avant de lancer le téléchargeur, que le volume et le
+// quota peuvent accueillir le fichier estimé, marge comprise. La place est
+// réservée jusqu'à l'appel de release, pour que deux travaux simultanés ne
+// comptent pas deux fois sur le même espace libre. Aucune requête
+// d'informations n'est faite ici: sans aperçu en cache, seule la marge est
+// vérifiée jusqu'à l'ajustement par adjust.
+func reserveSpace(ctx context.Context, job *job, url string) (*spaceReservation, error) {
+	var need int64
+	if info := cachedVideoInfo(url); info != nil {
+		need = info.estimatedSize()
+	}
+	deadline := time.Now().Add(spaceQueueTimeout)
+	waiting := false
+	for {
+		err := tryReserve(job, need)
+		if err == nil {
+			if waiting {
+				job.appendLog("Espace disponible, reprise du travail")
+				job.update(func(s *jobStatus) { s.Status = "préparation" })
+			}
+			return &spaceReservation{need: need}, nil
+		}
+		if storage.WhenFull != "queue" || time.Now().After(deadline) {
+			return nil, err
+		}
+		if !waiting {
+			job.appendLog(fmt.Sprintf("%v; travail mis en attente", err))
+			job.update(func(s *jobStatus) { s.Status = "en attente d'espace" })
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(spaceRetryInterval):
+		}
+	}
+}
+
+func (r *spaceReservation) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reserveMu.Lock()
+	reserved -= r.need
+	reserveMu.Unlock()
+	r.need = 0
+}
+
+// adjust recalcule la place nécessaire d'après le fichier d'informations
+// écrit par le téléchargeur, qui décrit les formats retenus pour ce travail
+// (sélecteur, mode audio, format explicite). Faute de place, le travail est
+// interrompu: le téléchargement a commencé, il n'est plus mis en attente.
+func (r *spaceReservation) adjust(job *job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.adjusted {
+		return
+	}
+	r.adjusted = true
+	job.mu.RLock()
+	path := job.infoPath
+	job.mu.RUnlock()
+	if path == "" {
+		return
+	}
+	info, err := readInfoJSON(path)
+	if err != nil {
+		return
+	}
+	need := info.estimatedSize()
+	if need == 0 {
+		job.appendLog("Taille non annoncée: seule la marge d'espace libre est vérifiée")
+		return
+	}
+	if delta := need - r.need; delta <= 0 {
+		reserveMu.Lock()
+		reserved += delta
+		reserveMu.Unlock()
+	} else if err := tryReserve(job, delta); err != nil {
+		job.abort(err)
+		return
+	}
+	r.need = need
+}
+
+// tryReserve réserve need octets si le volume et le quota le permettent. Le
+// parcours du dossier et l'élagage se font hors du verrou, pour ne pas
+// bloquer les autres réservations; la vérification est refaite ensuite.
+func tryReserve(job *job, need int64) error {
+	margin := storage.MarginMB << 20
+	if need/10 > margin {
+		margin = need / 10
+	}
+	free, _, ferr := diskSpace(baseDir)
+	if ferr != nil {
+		log.Printf("Espace libre inconnu sur %s: %v\n", baseDir, ferr)
+	}
+	quota := storage.QuotaMB << 20
+	for pruned := false; ; pruned = true {
+		var files []storedFile
+		var used int64
+		if quota > 0 {
+			files = downloadFiles()
+			for _, f := range files {
+				used += f.Size
+			}
+		}
+		reserveMu.Lock()
+		if ferr == nil {
+			if avail := int64(free) - reserved; avail < need+margin {
+				reserveMu.Unlock()
+				return fmt.Errorf("espace disque insuffisant: %s disponibles, %s nécessaires", formatBytes(avail), formatBytes(need+margin))
+			}
+		}
+		over := used + reserved + need - quota
+		if quota == 0 || over <= 0 {
+			reserved += need
+			reserveMu.Unlock()
+			return nil
+		}
+		reserveMu.Unlock()
+		if !storage.PruneOldest {
+			return fmt.Errorf("quota de %s atteint (%s utilisés)", formatBytes(quota), formatBytes(used))
+		}
+		if pruned || pruneOldest(job, files, over) < over {
+			return fmt.Errorf("quota de %s atteint malgré la mise à la corbeille des plus anciens fichiers", formatBytes(quota))
+		}
+	}
+}
+
+// pruneOldest place les fichiers les plus anciens dans la corbeille, d'où
+// ils peuvent être restaurés, jusqu'à libérer want octets de quota; elle
+// renvoie la place effectivement libérée.
+func pruneOldest(job *job, files []storedFile, want int64) int64 {
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime.Before(files[j].ModTime) })
+	var freed int64
+	for _, f := range files {
+		if freed >= want {
+			break
+		}
+		if err := trashLibraryItem(libraryItem{Path: f.Path}); err != nil {
+			job.appendLog(fmt.Sprintf("Mise à la corbeille de %s impossible: %v", filepath.Base(f.Path), err))
+			continue
+		}
+		job.appendLog(fmt.Sprintf("Quota: %s placé dans la corbeille (%s)", filepath.Base(f.Path), formatBytes(f.Size)))
+		freed += f.Size
+	}
+	return freed
+}
+
+// downloadFiles recense les fichiers multimédias du dossier de
+// téléchargement, corbeille, dossiers cachés et autres dossiers de la
+// bibliothèque qui y seraient rangés exclus.
+func downloadFiles() []storedFile {
+	var others []string
+	for _, f := range library.folders {
+		if f.Path != filepath.Clean(baseDir) {
+			others = append(others, f.Path+string(filepath.Separator))
+		}
+	}
+	var files []storedFile
+	walkFiles(baseDir, func(path string, d fs.DirEntry) {
+		if _, ok := mediaExtensions[strings.ToLower(filepath.Ext(path))]; !ok {
+			return
+		}
+		for _, o := range others {
+			if strings.HasPrefix(path, o) {
+				return
+			}
+		}
+		if fi, err := d.Info(); err == nil {
+			files = append(files, storedFile{Path: path, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+	})
+	return files
+}
+
+func currentUsage() (*storageUsage, error) {
+	free, total, err := diskSpace(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	u := &storageUsage{Dir: baseDir, Free: free, Total: total, Quota: storage.QuotaMB << 20, Margin: storage.MarginMB << 20}
+	for _, f := range downloadFiles() {
+		u.Used += f.Size
+		u.Files++
+	}
+	reserveMu.Lock()
+	u.Reserved = reserved
+	reserveMu.Unlock()
+	return u, nil
+}
+
+func storageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	usage, err := currentUsage()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(storageResponse{OK: false, Error: err.Error()})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(storageResponse{OK: true, Usage: usage})
+}
+
+func formatBytes(n int64) string {
+	units := []string{"o", "Ko", "Mo", "Go", "To"}
+	v := float64(n)
+	i := 0
+	for (v >= 1024 || v <= -1024) && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var subtitleLangRe = regexp.MustCompile(`^[A-Za-z]{2,3}(?:-[A-Za-z0-9]+)*$`)
+
+// subtitleOptions décrit les sous-titres à récupérer: manuels et/ou
+// automatiques, convertis en SRT, puis intégrés au MP4 ou laissés à côté.
+type subtitleOptions struct {
+	Languages []string `json:"languages"`
+	Manual    bool     `json:"manual"`
+	Auto      bool     `json:"auto"`
+	Embed     bool     `json:"embed"`
+}
+
+type subtitleTrack struct {
+	Ext  string `json:"ext"`
+	Name string `json:"name,omitempty"`
+}
+
+var subtitleExtensions = map[string]bool{
+	".vtt": true, ".srt": true, ".ttml": true, ".srv1": true, ".srv2": true, ".srv3": true, ".json3": true, ".ass": true, ".lrc": true,
+}
+
+func validateSubtitleOptions(p preset, opts *subtitleOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if len(opts.Languages) == 0 {
+		return fmt.Errorf("aucune langue de sous-titres indiquée")
+	}
+	for i, lang := range opts.Languages {
+		lang = strings.TrimSpace(lang)
+		if !subtitleLangRe.MatchString(lang) {
+			return fmt.Errorf("langue de sous-titres %q invalide", lang)
+		}
+		opts.Languages[i] = lang
+	}
+	if !opts.Manual && !opts.Auto {
+		opts.Manual = true
+	}
+	if opts.Embed && (p.Mode != "video" || expectedExtension(p) != "mp4") {
+		return fmt.Errorf("les sous-titres ne peuvent être intégrés qu'en MP4")
+	}
+	return nil
+}
+
+func subtitleArgs(opts *subtitleOptions) []string {
+	if opts == nil {
+		return nil
+	}
+	var args []string
+	if opts.Manual {
+		args = append(args, "--write-sub")
+	}
+	if opts.Auto {
+		args = append(args, "--write-auto-sub")
+	}
+	args = append(args, "--sub-lang", strings.Join(opts.Languages, ","), "--convert-subs", "srt")
+	if opts.Embed {
+		args = append(args, "--embed-subs")
+	}
+	return args
+}
+
+func isSubtitleFile(path string) bool {
+	return subtitleExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// subtitleSidecars retrouve les fichiers de sous-titres restés sur disque;
+// la conversion SRT remplace l'extension du fichier annoncé par le téléchargeur.
+func subtitleSidecars(written []string) []string {
+	var files []string
+	for _, path := range written {
+		srt := strings.TrimSuffix(path, filepath.Ext(path)) + ".srt"
+		if _, err := os.Stat(srt); err == nil {
+			files = append(files, srt)
+		} else if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+func subtitleLanguages(tracks map[string][]subtitleTrack) []string {
+	langs := make([]string, 0, len(tracks))
+	for lang := range tracks {
+		if lang != "live_chat" {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
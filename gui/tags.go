@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tagOptions porte les étiquettes saisies pour un travail; elles priment sur
+// celles déduites des informations de la vidéo.
+type tagOptions struct {
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+	Date   string `json:"date"`
+}
+
+var (
+	tagDateRe        = regexp.MustCompile(`^\d{4}(?:-\d{2}-\d{2})?$`)
+	artistSeparators = []string{" - ", " – ", " — ", " | "}
+	titleNoiseRe     = regexp.MustCompile(`(?i)\s*[\(\[](?:official\s*(?:music\s*)?(?:video|audio|clip|lyric video|visualizer)|clip officiel|audio officiel|lyrics?|paroles|hd|4k|hq)[\)\]]`)
+	channelSuffixRe  = regexp.MustCompile(`(?i)(?:\s+-\s+topic|vevo|\s+official)$`)
+)
+
+// embedExtensions liste les conteneurs dans lesquels le téléchargeur sait
+// intégrer la miniature.
+var embedExtensions = map[string]bool{"mp3": true, "m4a": true, "mp4": true}
+
+func validateMetadataOptions(p preset, opts jobOptions) error {
+	if opts.Tags.Date != "" && !tagDateRe.MatchString(opts.Tags.Date) {
+		return fmt.Errorf("date %q invalide (AAAA ou AAAA-MM-JJ)", opts.Tags.Date)
+	}
+	if !opts.EmbedThumbnail {
+		return nil
+	}
+	if ext := expectedExtension(p); !embedExtensions[ext] {
+		return fmt.Errorf("la pochette ne peut être intégrée qu'en MP3, M4A ou MP4 (format %q)", ext)
+	}
+	return nil
+}
+
+func embedArgs(opts jobOptions) []string {
+	var args []string
+	if opts.EmbedMetadata {
+		args = append(args, "--add-metadata")
+	}
+	if opts.EmbedThumbnail {
+		args = append(args, "--embed-thumbnail")
+	}
+	return args
+}
+
+// splitArtistTitle découpe un titre de clip « Artiste - Titre »; sans
+// séparateur, l'artiste retombe sur le nom de la chaîne.
+func splitArtistTitle(title, channel string) (string, string) {
+	clean := strings.TrimSpace(titleNoiseRe.ReplaceAllString(title, ""))
+	for _, sep := range artistSeparators {
+		if i := strings.Index(clean, sep); i > 0 {
+			artist := strings.TrimSpace(clean[:i])
+			song := strings.TrimSpace(clean[i+len(sep):])
+			if artist != "" && song != "" {
+				return artist, song
+			}
+		}
+	}
+	return strings.TrimSpace(channelSuffixRe.ReplaceAllString(channel, "")), clean
+}
+
+// buildTags calcule les étiquettes à écrire dans le fichier final.
+func buildTags(opts jobOptions, info *videoInfo) map[string]string {
+	tags := make(map[string]string)
+	if info != nil && opts.SplitArtist {
+		channel := info.Channel
+		if channel == "" {
+			channel = info.Uploader
+		}
+		artist, title := info.Artist, info.Track
+		if artist == "" || title == "" {
+			artist, title = splitArtistTitle(info.Title, channel)
+		}
+		tags["artist"], tags["title"] = artist, title
+		if info.Album != "" {
+			tags["album"] = info.Album
+		}
+	}
+	if info != nil && opts.EmbedMetadata {
+		if d, err := time.Parse("20060102", info.UploadDate); err == nil {
+			tags["date"] = d.Format("2006-01-02")
+		}
+	}
+	if opts.Tags.Title != "" {
+		tags["title"] = opts.Tags.Title
+	}
+	if opts.Tags.Artist != "" {
+		tags["artist"] = opts.Tags.Artist
+	}
+	if opts.Tags.Album != "" {
+		tags["album"] = opts.Tags.Album
+	}
+	if opts.Tags.Date != "" {
+		tags["date"] = opts.Tags.Date
+	}
+	for k, v := range tags {
+		if v == "" {
+			delete(tags, k)
+		}
+	}
+	return tags
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
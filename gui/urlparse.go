@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Genres d'URL reconnus par parseVideoURL.
+const (
+	urlKindVideo    = "video"
+	urlKindPlaylist = "playlist"
+	urlKindChannel  = "channel"
+	urlKindExternal = "external"
+)
+
+var (
+	videoIDRe     = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	playlistIDRe  = regexp.MustCompile(`^[A-Za-z0-9_-]{2,64}$`)
+	channelPathRe = regexp.MustCompile(`^(@[\w.\-]{3,30}|channel/UC[\w-]{22}|c/[^/]+|user/[^/]+)(?:/(?:videos|shorts|streams|featured|playlists|live|about)?)?$`)
+	schemeRe      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.\-]*:`)
+)
+
+// youtubeHosts liste les domaines YouTube, une fois retirés les préfixes
+// www., m., music. et gaming.
+var youtubeHosts = map[string]bool{
+	"youtube.com":          true,
+	"youtu.be":             true,
+	"youtube-nocookie.com": true,
+}
+
+// videoPathPrefixes sont les chemins dont le segment suivant est l'identifiant de la vidéo.
+var videoPathPrefixes = []string{"shorts", "embed", "live", "v", "e"}
+
+// videoURL est le résultat typé de l'analyse d'une URL collée par l'utilisateur.
+type videoURL struct {
+	Kind       string  `json:"kind"`
+	VideoID    string  `json:"videoId,omitempty"`
+	PlaylistID string  `json:"playlistId,omitempty"`
+	Channel    string  `json:"channel,omitempty"`
+	Timestamp  float64 `json:"timestamp,omitempty"`
+	Normalized string  `json:"normalized"`
+	Original   string  `json:"original"`
+	// host est l'hôte saisi, en minuscules et sans point final, avant toute
+	// canonisation; c'est lui que vérifie la politique d'URL.
+	host string
+}
+
+// parseVideoURL reconnaît les formes courantes des URL YouTube (youtu.be,
+// watch, shorts, embed, live, v, nocookie, attribution_link, chaînes et
+// playlists) et les ramène à une URL canonique. Les URL d'autres sites sont
+// acceptées telles quelles, avec le genre external.
+func parseVideoURL(raw string) (*videoURL, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, fmt.Errorf("URL vide")
+	}
+	if strings.ContainsAny(trimmed, " \t\r\n") {
+		return nil, fmt.Errorf("l'URL %q contient des espaces", trimmed)
+	}
+	withScheme := trimmed
+	if strings.HasPrefix(withScheme, "//") {
+		withScheme = "https:" + withScheme
+	} else if !schemeRe.MatchString(withScheme) || isHostPort(withScheme) {
+		withScheme = "https://" + withScheme
+	}
+	u, err := url.Parse(withScheme)
+	if err != nil {
+		return nil, fmt.Errorf("URL %q illisible", trimmed)
+	}
+	result := &videoURL{Original: trimmed, host: strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		result.Kind = urlKindExternal
+		result.Normalized = withScheme
+		return result, nil
+	}
+	host := canonicalHost(u.Hostname())
+	if host == "" || !strings.Contains(host, ".") {
+		return nil, fmt.Errorf("URL %q sans nom de domaine valide", trimmed)
+	}
+	if !youtubeHosts[host] {
+		result.Kind = urlKindExternal
+		result.Normalized = u.String()
+		return result, nil
+	}
+	if err := parseYouTubeURL(host, u, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isHostPort distingue "youtube.com:443/watch" d'un véritable schéma.
+func isHostPort(s string) bool {
+	i := strings.Index(s, ":")
+	rest := s[i+1:]
+	return i > 0 && len(rest) > 0 && rest[0] >= '0' && rest[0] <= '9'
+}
+
+func canonicalHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, prefix := range []string{"www.", "m.", "music.", "gaming."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	return host
+}
+
+func parseYouTubeURL(host string, u *url.URL, result *videoURL) error {
+	q := u.Query()
+	path := strings.Trim(u.Path, "/")
+	segments := strings.Split(path, "/")
+
+	if path == "attribution_link" {
+		target := q.Get("u")
+		if target == "" {
+			return fmt.Errorf("lien d'attribution sans destination")
+		}
+		inner, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("lien d'attribution illisible")
+		}
+		// Seul un chemin relatif est suivi: une destination sur un autre
+		// site ne doit pas être réécrite en URL YouTube.
+		if inner.Scheme != "" || inner.Host != "" {
+			return fmt.Errorf("lien d'attribution vers un autre site refusé")
+		}
+		return parseYouTubeURL("youtube.com", u.ResolveReference(inner), result)
+	}
+
+	result.Timestamp = urlTimestamp(u)
+	if list := q.Get("list"); list != "" {
+		if !playlistIDRe.MatchString(list) {
+			return fmt.Errorf("identifiant de playlist %q invalide", list)
+		}
+		result.PlaylistID = list
+	}
+
+	var id string
+	switch {
+	case host == "youtu.be":
+		id = segments[0]
+		if id == "" {
+			return fmt.Errorf("lien youtu.be sans identifiant de vidéo")
+		}
+	case path == "watch":
+		id = q.Get("v")
+		if id == "" && result.PlaylistID == "" {
+			return fmt.Errorf("URL de lecture sans paramètre v=")
+		}
+	case path == "playlist" || path == "embed/videoseries":
+		if result.PlaylistID == "" {
+			return fmt.Errorf("URL de playlist sans paramètre list=")
+		}
+	case len(segments) >= 2 && containsString(videoPathPrefixes, segments[0]):
+		id = segments[1]
+	default:
+		if m := channelPathRe.FindStringSubmatch(path); m != nil {
+			result.Kind = urlKindChannel
+			result.Channel = m[1]
+			result.Normalized = "https://www.youtube.com/" + m[1]
+			return nil
+		}
+		return fmt.Errorf("URL YouTube non reconnue: /%s", path)
+	}
+
+	if id == "" {
+		result.Kind = urlKindPlaylist
+		result.Normalized = "https://www.youtube.com/playlist?list=" + result.PlaylistID
+		return nil
+	}
+	if !videoIDRe.MatchString(id) {
+		return fmt.Errorf("identifiant de vidéo %q invalide (11 caractères attendus)", id)
+	}
+	result.Kind = urlKindVideo
+	result.VideoID = id
+	result.Normalized = "https://www.youtube.com/watch?v=" + id
+	return nil
+}
+
+// urlTimestamp lit le paramètre t= (ou start=), y compris dans le fragment;
+// une valeur illisible est ignorée.
+func urlTimestamp(u *url.URL) float64 {
+	q := u.Query()
+	raw := q.Get("t")
+	if raw == "" {
+		raw = q.Get("start")
+	}
+	if raw == "" {
+		if frag, err := url.ParseQuery(u.Fragment); err == nil {
+			raw = frag.Get("t")
+		}
+	}
+	if v, err := parseTimestamp(raw); err == nil {
+		return v
+	}
+	return 0
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package main
+
+import "testing"
+
+func TestParseVideoURL(t *testing.T) {
+	const id = "dQw4w9WgXcQ"
+	const watch = "https://www.youtube.com/watch?v=" + id
+	const list = "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"
+
+	tests := []struct {
+		name       string
+		raw        string
+		kind       string
+		videoID    string
+		playlistID string
+		channel    string
+		timestamp  float64
+		normalized string
+	}{
+		// Formes de vidéo
+		{name: "watch", raw: watch, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "watch sans www", raw: "https://youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "watch mobile", raw: "https://m.youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "watch music", raw: "https://music.youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "watch http", raw: "http://www.youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "hôte en majuscules", raw: "https://WWW.YouTube.COM/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "hôte avec point final", raw: "https://www.youtube.com./watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "barre finale", raw: "https://www.youtube.com/watch/?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "espaces autour", raw: "  " + watch + "\n", kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "paramètres parasites", raw: watch + "&feature=share&si=abc", kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "youtu.be", raw: "https://youtu.be/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "youtu.be avec si", raw: "https://youtu.be/" + id + "?si=xyz", kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "shorts", raw: "https://www.youtube.com/shorts/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "embed", raw: "https://www.youtube.com/embed/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "nocookie", raw: "https://www.youtube-nocookie.com/embed/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "live", raw: "https://www.youtube.com/live/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "v", raw: "https://www.youtube.com/v/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "e", raw: "https://www.youtube.com/e/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+
+		// Schéma absent, relatif ou hôte avec port
+		{name: "sans schéma", raw: "youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "sans schéma www", raw: "www.youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "sans schéma youtu.be", raw: "youtu.be/" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "relatif au schéma", raw: "//www.youtube.com/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "hôte et port", raw: "youtube.com:443/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "schéma, hôte et port", raw: "https://www.youtube.com:443/watch?v=" + id, kind: urlKindVideo, videoID: id, normalized: watch},
+
+		// Horodatages
+		{name: "t en secondes", raw: watch + "&t=90", kind: urlKindVideo, videoID: id, timestamp: 90, normalized: watch},
+		{name: "t avec s", raw: watch + "&t=90s", kind: urlKindVideo, videoID: id, timestamp: 90, normalized: watch},
+		{name: "t en minutes", raw: watch + "&t=1m30s", kind: urlKindVideo, videoID: id, timestamp: 90, normalized: watch},
+		{name: "t en heures", raw: watch + "&t=1h2m3s", kind: urlKindVideo, videoID: id, timestamp: 3723, normalized: watch},
+		{name: "youtu.be t", raw: "https://youtu.be/" + id + "?t=42", kind: urlKindVideo, videoID: id, timestamp: 42, normalized: watch},
+		{name: "start", raw: "https://www.youtube.com/embed/" + id + "?start=15", kind: urlKindVideo, videoID: id, timestamp: 15, normalized: watch},
+		{name: "fragment t", raw: watch + "#t=75", kind: urlKindVideo, videoID: id, timestamp: 75, normalized: watch},
+		{name: "t illisible ignoré", raw: watch + "&t=abc", kind: urlKindVideo, videoID: id, normalized: watch},
+
+		// Liens d'attribution
+		{name: "attribution", raw: "https://www.youtube.com/attribution_link?a=x&u=%2Fwatch%3Fv%3D" + id + "%26feature%3Dshare", kind: urlKindVideo, videoID: id, normalized: watch},
+		{name: "attribution avec t", raw: "https://www.youtube.com/attribution_link?u=/watch%3Fv%3D" + id + "%26t%3D30", kind: urlKindVideo, videoID: id, timestamp: 30, normalized: watch},
+
+		// Playlists
+		{name: "playlist", raw: "https://www.youtube.com/playlist?list=" + list, kind: urlKindPlaylist, playlistID: list, normalized: "https://www.youtube.com/playlist?list=" + list},
+		{name: "watch sans v avec list", raw: "https://www.youtube.com/watch?list=" + list, kind: urlKindPlaylist, playlistID: list, normalized: "https://www.youtube.com/playlist?list=" + list},
+		{name: "videoseries", raw: "https://www.youtube.com/embed/videoseries?list=" + list, kind: urlKindPlaylist, playlistID: list, normalized: "https://www.youtube.com/playlist?list=" + list},
+		{name: "vidéo dans une playlist", raw: watch + "&list=" + list, kind: urlKindVideo, videoID: id, playlistID: list, normalized: watch},
+
+		// Chaînes
+		{name: "handle", raw: "https://www.youtube.com/@GoogleDevelopers", kind: urlKindChannel, channel: "@GoogleDevelopers", normalized: "https://www.youtube.com/@GoogleDevelopers"},
+		{name: "handle onglet", raw: "https://www.youtube.com/@GoogleDevelopers/videos", kind: urlKindChannel, channel: "@GoogleDevelopers", normalized: "https://www.youtube.com/@GoogleDevelopers"},
+		{name: "channel", raw: "https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", kind: urlKindChannel, channel: "channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", normalized: "https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw"},
+		{name: "c", raw: "https://www.youtube.com/c/GoogleDevelopers/featured", kind: urlKindChannel, channel: "c/GoogleDevelopers", normalized: "https://www.youtube.com/c/GoogleDevelopers"},
+		{name: "user", raw: "youtube.com/user/GoogleDevelopers", kind: urlKindChannel, channel: "user/GoogleDevelopers", normalized: "https://www.youtube.com/user/GoogleDevelopers"},
+
+		// Autres sites
+		{name: "externe", raw: "https://vimeo.com/76979871", kind: urlKindExternal, normalized: "https://vimeo.com/76979871"},
+		{name: "externe sans schéma", raw: "vimeo.com/76979871", kind: urlKindExternal, normalized: "https://vimeo.com/76979871"},
+		{name: "externe avec port", raw: "example.com:8080/video.mp4", kind: urlKindExternal, normalized: "https://example.com:8080/video.mp4"},
+		{name: "schéma non web", raw: "ftp://example.com/video.mp4", kind: urlKindExternal, normalized: "ftp://example.com/video.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVideoURL(tt.raw)
+			if err != nil {
+				t.Fatalf("parseVideoURL(%q): erreur inattendue %v", tt.raw, err)
+			}
+			if got.Kind != tt.kind || got.VideoID != tt.videoID || got.PlaylistID != tt.playlistID || got.Channel != tt.channel {
+				t.Errorf("parseVideoURL(%q) = genre %q vidéo %q playlist %q chaîne %q, attendu %q %q %q %q",
+					tt.raw, got.Kind, got.VideoID, got.PlaylistID, got.Channel, tt.kind, tt.videoID, tt.playlistID, tt.channel)
+			}
+			if got.Timestamp != tt.timestamp {
+				t.Errorf("parseVideoURL(%q).Timestamp = %v, attendu %v", tt.raw, got.Timestamp, tt.timestamp)
+			}
+			if got.Normalized != tt.normalized {
+				t.Errorf("parseVideoURL(%q).Normalized = %q, attendu %q", tt.raw, got.Normalized, tt.normalized)
+			}
+		})
+	}
+}
+
+func TestParseVideoURLRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "vide", raw: ""},
+		{name: "blancs", raw: "   "},
+		{name: "espace interne", raw: "https://www.youtube.com/watch?v=dQw4w9 WgXcQ"},
+		{name: "sans domaine", raw: "https://localhost/watch?v=dQw4w9WgXcQ"},
+		{name: "texte", raw: "bonjour"},
+		{name: "watch sans v", raw: "https://www.youtube.com/watch"},
+		{name: "identifiant trop court", raw: "https://www.youtube.com/watch?v=abc"},
+		{name: "identifiant trop long", raw: "https://www.youtube.com/watch?v=dQw4w9WgXcQx"},
+		{name: "identifiant invalide", raw: "https://youtu.be/dQw4w9WgX!Q"},
+		{name: "youtu.be sans identifiant", raw: "https://youtu.be/"},
+		{name: "shorts sans identifiant", raw: "https://www.youtube.com/shorts/"},
+		{name: "playlist sans list", raw: "https://www.youtube.com/playlist"},
+		{name: "list invalide", raw: "https://www.youtube.com/playlist?list=a!b"},
+		{name: "videoseries sans list", raw: "https://www.youtube.com/embed/videoseries"},
+		{name: "chemin inconnu", raw: "https://www.youtube.com/feed/subscriptions"},
+		{name: "racine", raw: "https://www.youtube.com/"},
+		{name: "attribution sans destination", raw: "https://www.youtube.com/attribution_link?a=x"},
+		{name: "attribution vers un autre site", raw: "https://www.youtube.com/attribution_link?u=https%3A%2F%2Fevil.com%2Fwatch%3Fv%3DdQw4w9WgXcQ"},
+		{name: "attribution relative au schéma", raw: "https://www.youtube.com/attribution_link?u=%2F%2Fevil.com%2Fwatch%3Fv%3DdQw4w9WgXcQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseVideoURL(tt.raw); err == nil {
+				t.Errorf("parseVideoURL(%q) = %+v, erreur attendue", tt.raw, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var videoHeights = []int{480, 720, 1080, 1440, 2160}
+
+// videoCodecFilters donne les préfixes vcodec reconnus par le sélecteur de
+// format. YouTube annonce le VP9 sous la forme "vp9" ou "vp09.xx" selon le
+// profil; "vp" seul retiendrait aussi le VP8.
+var videoCodecFilters = map[string][]string{
+	"h264": {"avc1"},
+	"vp9":  {"vp9", "vp09"},
+	"av1":  {"av01"},
+}
+
+// applyVideoOptions surcharge la résolution maximale, le codec, la fréquence
+// d'images et la préférence HDR du préréglage pour un travail.
+func applyVideoOptions(p *preset, maxHeight int, codec string, maxFPS int, hdr string) error {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+	hdr = strings.ToLower(strings.TrimSpace(hdr))
+	if maxHeight == 0 && codec == "" && maxFPS == 0 && hdr == "" {
+		return nil
+	}
+	if p.Mode != "video" {
+		return fmt.Errorf("le préréglage %q ne produit pas de vidéo", p.Name)
+	}
+	if maxHeight != 0 {
+		if !containsInt(videoHeights, maxHeight) {
+			return fmt.Errorf("résolution maximale %dp non prise en charge", maxHeight)
+		}
+		p.MaxHeight = maxHeight
+	}
+	if codec != "" {
+		if codec == "avc" || codec == "h.264" {
+			codec = "h264"
+		}
+		if _, ok := videoCodecFilters[codec]; !ok {
+			return fmt.Errorf("codec vidéo %q non pris en charge (h264, vp9, av1)", codec)
+		}
+		p.VideoCodec = codec
+	}
+	if maxFPS != 0 {
+		if maxFPS != 30 && maxFPS != 60 {
+			return fmt.Errorf("fréquence d'images %d non prise en charge (30, 60)", maxFPS)
+		}
+		p.MaxFPS = maxFPS
+	}
+	switch hdr {
+	case "":
+	case "sdr", "hdr":
+		p.HDR = hdr
+	default:
+		return fmt.Errorf("préférence HDR %q invalide (sdr, hdr)", hdr)
+	}
+	return nil
+}
+
+// dynamicRangeSupported indique si le téléchargeur renseigne dynamic_range:
+// youtube-dl ne connaît pas ce champ et rejette tout sélecteur qui le filtre.
+func dynamicRangeSupported() bool {
+	return backendSupports("--compat-options")
+}
+
+func hasVideoConstraints(p preset) bool {
+	return p.MaxHeight > 0 || p.VideoCodec != "" || p.MaxFPS > 0 || p.HDR != ""
+}
+
+// videoFormatSelector construit un sélecteur qui tente d'abord toutes les
+// préférences, puis les relâche une à une sans jamais dépasser la hauteur maximale.
+func videoFormatSelector(p preset) string {
+	height := ""
+	if p.MaxHeight > 0 {
+		height = "[height<=" + strconv.Itoa(p.MaxHeight) + "]"
+	}
+	fps := ""
+	if p.MaxFPS > 0 {
+		fps = "[fps<=" + strconv.Itoa(p.MaxFPS) + "]"
+	}
+	codecs := []string{"[vcodec!*=av01]"}
+	if prefixes, ok := videoCodecFilters[p.VideoCodec]; ok {
+		codecs = codecs[:0]
+		for _, prefix := range prefixes {
+			codecs = append(codecs, "[vcodec^="+prefix+"]")
+		}
+	}
+	ext := ""
+	if p.Container == "mp4" && (p.VideoCodec == "" || p.VideoCodec == "h264") {
+		ext = "[ext=mp4]"
+	}
+	// Avec yt-dlp, le ? placé après l'opérateur laisse passer les formats dont
+	// dynamic_range n'est pas renseigné; sous youtube-dl la préférence est ignorée.
+	dynamic := ""
+	if dynamicRangeSupported() {
+		switch p.HDR {
+		case "sdr":
+			dynamic = "[dynamic_range=?SDR]"
+		case "hdr":
+			dynamic = "[dynamic_range^=HDR]"
+		}
+	}
+	audio := "bestaudio"
+	if p.Container == "mp4" {
+		audio = "bestaudio[ext=m4a]"
+	}
+
+	var videos []string
+	for _, c := range codecs {
+		videos = append(videos, "bestvideo"+ext+height+fps+c+dynamic)
+	}
+	for _, c := range codecs {
+		videos = append(videos, "bestvideo"+height+fps+c+dynamic)
+	}
+	for _, c := range codecs {
+		videos = append(videos, "bestvideo"+height+fps+c)
+	}
+	videos = append(videos, "bestvideo"+height+fps, "bestvideo"+height)
+	var alternatives []string
+	seen := make(map[string]bool)
+	add := func(alt string) {
+		if !seen[alt] {
+			seen[alt] = true
+			alternatives = append(alternatives, alt)
+		}
+	}
+	for _, v := range videos {
+		add(v + "+" + audio)
+		if audio != "bestaudio" {
+			add(v + "+bestaudio")
+		}
+	}
+	add("best" + ext + height)
+	add("best" + height)
+	return strings.Join(alternatives, "/")
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}